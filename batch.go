@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+)
+
+// batchOutputSuffix marks results written next to their prompts ("monday.md" -> "monday.out.md"),
+// so they are not picked up as prompts themselves.
+const batchOutputSuffix = ".out"
+
+// batchJob is one prompt file of a batch run and where its result goes.
+type batchJob struct {
+	Prompt string
+	Output string
+}
+
+// batchPrompts expands directories (their *.md and *.txt files) and glob patterns into prompt
+// files, sorted and without duplicates or earlier results.
+func batchPrompts(args []string) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	add := func(p string) {
+		stem := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		if !seen[p] && !strings.HasSuffix(stem, batchOutputSuffix) {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		switch {
+		case err == nil && info.IsDir():
+			entries, err := os.ReadDir(arg)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				if ext := strings.ToLower(filepath.Ext(e.Name())); !e.IsDir() && (ext == ".md" || ext == ".txt") {
+					add(filepath.Join(arg, e.Name()))
+				}
+			}
+		case err == nil:
+			add(arg)
+		default:
+			matches, gerr := filepath.Glob(arg)
+			if gerr != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", arg, gerr)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no prompt files match %s", arg)
+			}
+			for _, m := range matches {
+				if info, err := os.Stat(m); err == nil && !info.IsDir() {
+					add(m)
+				}
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// batchOutputPath is where the result for prompt goes: outDir/NAME.md, or NAME.out.md next to it.
+func batchOutputPath(prompt, outDir string) string {
+	base := filepath.Base(prompt)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	if outDir != "" {
+		return filepath.Join(outDir, stem+".md")
+	}
+	return filepath.Join(filepath.Dir(prompt), stem+batchOutputSuffix+".md")
+}
+
+// runBatchJob generates one result and writes it through a temporary file, so an interrupted run
+// never leaves a partial output that --resume would skip.
+func runBatchJob(chain []chatProvider, policy retryPolicy, job batchJob, vars map[string]string, db *sql.DB) (chatProvider, error) {
+	prompt, err := loadPrompt(job.Prompt, vars)
+	if err != nil {
+		return nil, err
+	}
+	if !prompt.hasBody() {
+		return nil, fmt.Errorf("setting file is empty")
+	}
+	provider, res, err := streamChatChain(chain, policy, chatRequest{Messages: prompt.Messages, Params: prompt.Params, Source: "batch", UsageDB: db},
+		func(string) {}, func(chatProvider, bool) {})
+	if err != nil {
+		return provider, err
+	}
+	tmp := job.Output + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.TrimSpace(res.Content)+"\n"), 0644); err != nil {
+		return provider, fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := os.Rename(tmp, job.Output); err != nil {
+		os.Remove(tmp)
+		return provider, fmt.Errorf("failed to write output file: %w", err)
+	}
+	return provider, nil
+}
+
+// Batch runs "cairn batch": generate results for many prompt files with bounded concurrency.
+func Batch(args []string) error {
+	fs := pflag.NewFlagSet("batch", pflag.ContinueOnError)
+	configPath := fs.StringP("config", "c", "~/.cairn.toml", "Path to config file")
+	outDir := fs.StringP("out-dir", "O", "", "Write results into this directory as NAME.md (default: NAME.out.md next to each prompt)")
+	jobs := fs.IntP("jobs", "j", 4, "Number of prompts to run at once")
+	resume := fs.Bool("resume", false, "Skip prompts whose output file already exists")
+	varFlags := fs.StringArray("var", nil, "Set a prompt template variable for every prompt, NAME=VALUE (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: cairn batch [--out-dir DIR] [--jobs N] [--resume] DIR|GLOB|FILE...")
+	}
+	if *jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	vars, err := parseVars(*varFlags)
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	chain, err := writerProviders(config)
+	if err != nil {
+		return err
+	}
+	prompts, err := batchPrompts(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(prompts) == 0 {
+		return fmt.Errorf("no prompt files found (directories are searched for *.md and *.txt)")
+	}
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	var todo []batchJob
+	outputs := map[string]string{}
+	skipped := 0
+	for _, p := range prompts {
+		job := batchJob{Prompt: p, Output: batchOutputPath(p, *outDir)}
+		if filepath.Clean(job.Output) == filepath.Clean(p) {
+			return fmt.Errorf("result for %s would overwrite the prompt itself; use another --out-dir", p)
+		}
+		if other, ok := outputs[job.Output]; ok {
+			return fmt.Errorf("%s and %s would both write %s", other, p, job.Output)
+		}
+		outputs[job.Output] = p
+		if _, err := os.Stat(job.Output); err == nil && *resume {
+			skipped++
+			continue
+		}
+		todo = append(todo, job)
+	}
+	fmt.Fprintf(os.Stderr, "Batch: %d prompt(s) to run, %d skipped, %d at a time\n", len(todo), skipped, *jobs)
+
+	// All jobs record token usage through one handle, whose single connection serializes the writes.
+	db, err := initHistoryDB()
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	policy := writerRetryPolicy(config.Writer)
+	failures := make([]error, len(todo))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, *jobs)
+	done := 0
+	for i, job := range todo {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, job batchJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			provider, err := runBatchJob(chain, policy, job, vars, db)
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if err != nil {
+				failures[i] = err
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s: failed: %v\n", done, len(todo), job.Prompt, err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s → %s (%s)\n", done, len(todo), job.Prompt, job.Output, providerLabel(provider))
+		}(i, job)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range failures {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("  %s: %v", todo[i].Prompt, err))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Batch done: %d generated, %d skipped, %d failed\n", len(todo)-len(failed), skipped, len(failed))
+	if len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "Failed prompts:\n%s\n", strings.Join(failed, "\n"))
+		return fmt.Errorf("%d of %d prompts failed; rerun with --resume to retry only those", len(failed), len(todo))
+	}
+	return nil
+}
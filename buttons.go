@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// inlineButton is a URL button of an inline keyboard (Bot API InlineKeyboardButton).
+type inlineButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// inlineKeyboard is Bot API InlineKeyboardMarkup, sent as reply_markup.
+type inlineKeyboard struct {
+	InlineKeyboard [][]inlineButton `json:"inline_keyboard"`
+}
+
+var buttonRe = regexp.MustCompile(`^\s*\[([^\]\n]+)\]\(([^)\s]+)\)`)
+
+// parseButtonRow parses one keyboard row written as Markdown links: "[Open map](https://...) [Full entry](https://...)".
+func parseButtonRow(s string) ([]inlineButton, error) {
+	var row []inlineButton
+	rest := s
+	for strings.TrimSpace(rest) != "" {
+		m := buttonRe.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("invalid button row %q (use \"[Text](https://url) [Text 2](https://url2)\")", s)
+		}
+		if err := checkButtonURL(m[2]); err != nil {
+			return nil, err
+		}
+		row = append(row, inlineButton{Text: strings.TrimSpace(m[1]), URL: m[2]})
+		rest = rest[len(m[0]):]
+	}
+	if len(row) == 0 {
+		return nil, fmt.Errorf("empty button row")
+	}
+	return row, nil
+}
+
+// parseButtonRows parses each --button-row value into a keyboard row.
+func parseButtonRows(rows []string) ([][]inlineButton, error) {
+	var keyboard [][]inlineButton
+	for _, r := range rows {
+		row, err := parseButtonRow(r)
+		if err != nil {
+			return nil, err
+		}
+		keyboard = append(keyboard, row)
+	}
+	return keyboard, nil
+}
+
+// checkButtonURL accepts the URL schemes Telegram allows on buttons.
+func checkButtonURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid button URL %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "tg":
+		return nil
+	}
+	return fmt.Errorf("invalid button URL %q (use http, https or tg links)", raw)
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// chatSession is one "cairn chat" conversation, stored in the chats table of the history DB after
+// every exchange so it can be resumed.
+type chatSession struct {
+	ID    int64
+	Title string
+	// PromptPath is the prompt file the session started from, if any.
+	PromptPath string
+	// Model is the provider entry chosen with /model ("NAME" or "NAME:MODEL"); empty means the
+	// [writer] provider chain.
+	Model string
+	// Base is the number of leading messages from the prompt file (system message and examples),
+	// which /reset keeps.
+	Base      int
+	Messages  []chatMessage
+	CreatedAt string
+	UpdatedAt string
+}
+
+// lastReply returns the most recent assistant message of the conversation, or "".
+func (s *chatSession) lastReply() string {
+	for i := len(s.Messages) - 1; i >= s.Base; i-- {
+		if s.Messages[i].Role == "assistant" {
+			return s.Messages[i].Content
+		}
+	}
+	return ""
+}
+
+// saveChat inserts s, or updates it once it has an ID.
+func saveChat(s *chatSession) error {
+	db, err := initHistoryDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	data, err := json.Marshal(s.Messages)
+	if err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now().Format(historyTimeLayout)
+	if s.ID == 0 {
+		s.CreatedAt = s.UpdatedAt
+		res, err := db.Exec(`INSERT INTO chats (title, prompt_path, model, base_messages, messages, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			s.Title, s.PromptPath, s.Model, s.Base, string(data), s.CreatedAt, s.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		s.ID, err = res.LastInsertId()
+		return err
+	}
+	_, err = db.Exec(`UPDATE chats SET title = ?, model = ?, messages = ?, updated_at = ? WHERE id = ?`,
+		s.Title, s.Model, string(data), s.UpdatedAt, s.ID)
+	return err
+}
+
+// loadChat reads session id from the history DB; id 0 means the most recently updated one.
+func loadChat(id int64) (*chatSession, error) {
+	db, err := initHistoryDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	query := `SELECT id, title, COALESCE(prompt_path, ''), COALESCE(model, ''), base_messages, messages, created_at, updated_at FROM chats`
+	var row *sql.Row
+	if id == 0 {
+		row = db.QueryRow(query + ` ORDER BY updated_at DESC, id DESC LIMIT 1`)
+	} else {
+		row = db.QueryRow(query+` WHERE id = ?`, id)
+	}
+	var s chatSession
+	var messages string
+	err = row.Scan(&s.ID, &s.Title, &s.PromptPath, &s.Model, &s.Base, &messages, &s.CreatedAt, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		if id == 0 {
+			return nil, fmt.Errorf("no chat to resume")
+		}
+		return nil, fmt.Errorf("no chat #%d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(messages), &s.Messages); err != nil {
+		return nil, fmt.Errorf("chat #%d has an unreadable transcript: %w", s.ID, err)
+	}
+	return &s, nil
+}
+
+// printChats lists stored sessions, most recently updated first.
+func printChats(limit int) error {
+	db, err := initHistoryDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT id, title, COALESCE(model, ''), base_messages, messages, updated_at FROM chats
+		ORDER BY updated_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	n := 0
+	for rows.Next() {
+		var id int64
+		var title, model, messages, updated string
+		var base int
+		if err := rows.Scan(&id, &title, &model, &base, &messages, &updated); err != nil {
+			return err
+		}
+		if n == 0 {
+			fmt.Fprintln(tw, "ID\tUPDATED\tMODEL\tMESSAGES\tTITLE")
+		}
+		var msgs []chatMessage
+		json.Unmarshal([]byte(messages), &msgs)
+		if model == "" {
+			model = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\n", id, updated, model, len(msgs)-base, title)
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if n == 0 {
+		fmt.Fprintln(os.Stderr, "No chats yet")
+		return nil
+	}
+	return tw.Flush()
+}
+
+// chatChain returns the providers for entry, or the [writer] chain when entry is empty.
+func chatChain(config *Config, entry string) ([]chatProvider, error) {
+	if entry == "" {
+		return writerProviders(config)
+	}
+	p, err := providerEntry(config, entry)
+	if err != nil {
+		return nil, err
+	}
+	return []chatProvider{p}, nil
+}
+
+// readChatInput reads one message; a line ending in a backslash continues on the next line.
+func readChatInput(r *bufio.Reader) (string, error) {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasSuffix(line, "\\") && err == nil {
+			lines = append(lines, strings.TrimSuffix(line, "\\"))
+			fmt.Fprint(os.Stderr, ". ")
+			continue
+		}
+		lines = append(lines, line)
+		return strings.Join(lines, "\n"), err
+	}
+}
+
+const chatHelp = `Commands:
+  /save FILE     Write the last reply to FILE
+  /post          Post the last reply to the channel (flow "chat")
+  /model [NAME]  Show the provider, or switch to NAME or NAME:MODEL ("/model default" for [writer])
+  /reset         Forget the conversation (the prompt file's system message and examples stay)
+  /help          Show this help
+  /quit          Leave (also Ctrl-D); resume later with cairn chat --resume
+End a line with \ to continue the message on the next line.`
+
+// Chat runs "cairn chat": an interactive conversation with the writer's LLM providers, streamed
+// like -W and saved after every exchange.
+func Chat(args []string) error {
+	fs := pflag.NewFlagSet("chat", pflag.ContinueOnError)
+	configPath := fs.StringP("config", "c", "~/.cairn.toml", "Path to config file")
+	promptPath := fs.StringP("prompt", "p", "", "Start from a prompt file (system message, examples, context; its text is sent first)")
+	varFlags := fs.StringArray("var", nil, "Set a prompt template variable, NAME=VALUE (repeatable)")
+	resume := fs.String("resume", "", "Resume a chat by ID, or the latest one without an ID")
+	fs.Lookup("resume").NoOptDefVal = "latest"
+	list := fs.BoolP("list", "l", false, "List saved chats")
+	channel := fs.String("channel", "", "Channel profile for /post")
+	format := fs.String("format", "", "Input format of replies for /post: markdown, html or plain (default: the channel's format)")
+	verbose := fs.BoolP("verbose", "v", false, "Print the provider, model and generation settings of each request")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *list {
+		return printChats(20)
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if _, err := formatContent("", *format); err != nil {
+		return err
+	}
+	var s *chatSession
+	var params GenerationParams
+	var first string // prompt file text, sent as the first message
+	switch {
+	case *resume != "" && *promptPath != "":
+		return fmt.Errorf("--resume and --prompt cannot be combined (a resumed chat keeps its own prompt)")
+	case *resume != "":
+		var id int64
+		if *resume == "latest" && fs.NArg() > 0 {
+			*resume = fs.Arg(0) // --resume ID with a space
+		}
+		if *resume != "latest" {
+			if id, err = strconv.ParseInt(*resume, 10, 64); err != nil || id <= 0 {
+				return fmt.Errorf("--resume takes a chat ID (see cairn chat --list)")
+			}
+		}
+		if s, err = loadChat(id); err != nil {
+			return err
+		}
+		if s.PromptPath != "" {
+			// Generation settings come from the prompt file; the messages are already in the transcript.
+			if p, err := loadPrompt(s.PromptPath, nil); err == nil {
+				params = p.Params
+			}
+		}
+	default:
+		s = &chatSession{}
+		if *promptPath != "" {
+			vars, err := parseVars(*varFlags)
+			if err != nil {
+				return err
+			}
+			p, err := loadPrompt(*promptPath, vars)
+			if err != nil {
+				return err
+			}
+			params = p.Params
+			s.Messages = p.Messages
+			if p.hasBody() {
+				first = s.Messages[len(s.Messages)-1].Content
+				s.Messages = s.Messages[:len(s.Messages)-1]
+			}
+			s.Base = len(s.Messages)
+			if s.PromptPath, err = filepath.Abs(*promptPath); err != nil {
+				s.PromptPath = *promptPath
+			}
+		}
+	}
+	chain, err := chatChain(config, s.Model)
+	if err != nil {
+		return err
+	}
+	policy := writerRetryPolicy(config.Writer)
+	lastModel := chain[0].Model() // model of the last reply, recorded with /post
+
+	send := func(text string) {
+		s.Messages = append(s.Messages, chatMessage{Role: "user", Content: text})
+		provider, res, err := streamReply(chain, policy, chatRequest{Messages: s.Messages, Params: params, Source: "chat"}, os.Stdout, *verbose)
+		if err != nil {
+			s.Messages = s.Messages[:len(s.Messages)-1]
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		if len(chain) > 1 {
+			fmt.Fprintf(os.Stderr, "(%s)\n", providerLabel(provider))
+		}
+		lastModel = provider.Model()
+		s.Messages = append(s.Messages, chatMessage{Role: "assistant", Content: strings.TrimSpace(res.Content)})
+		if s.Title == "" {
+			s.Title = historySnippet(text, 60)
+		}
+		if err := saveChat(s); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save chat: %v\n", err)
+		}
+	}
+
+	if s.ID != 0 {
+		fmt.Fprintf(os.Stderr, "Resuming chat #%d (%s)\n", s.ID, s.Title)
+		for _, m := range s.Messages[s.Base:] {
+			if m.Role == "user" {
+				fmt.Fprintf(os.Stdout, "> %s\n", strings.ReplaceAll(m.Content, "\n", "\n> "))
+			} else {
+				fmt.Fprintf(os.Stdout, "%s\n\n", m.Content)
+			}
+		}
+	}
+	labels := make([]string, len(chain))
+	for i, p := range chain {
+		labels[i] = providerLabel(p)
+	}
+	fmt.Fprintf(os.Stderr, "Chatting with %s. /help for commands, /quit or Ctrl-D to leave.\n", strings.Join(labels, " → "))
+	if first != "" {
+		fmt.Fprintf(os.Stdout, "> %s\n", strings.ReplaceAll(first, "\n", "\n> "))
+		send(first)
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprint(os.Stderr, "> ")
+		line, err := readChatInput(in)
+		text := strings.TrimSpace(line)
+		if err != nil && text == "" {
+			if err == io.EOF {
+				fmt.Fprintln(os.Stderr)
+				break
+			}
+			return err
+		}
+		if text == "" {
+			continue
+		}
+		if !strings.HasPrefix(text, "/") {
+			send(text)
+			continue
+		}
+		cmd, arg, _ := strings.Cut(text, " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case "/quit", "/exit":
+			if s.ID != 0 {
+				fmt.Fprintf(os.Stderr, "Saved as chat #%d; resume with cairn chat --resume %d\n", s.ID, s.ID)
+			}
+			return nil
+		case "/help":
+			fmt.Fprintln(os.Stderr, chatHelp)
+		case "/reset":
+			s.Messages = s.Messages[:s.Base]
+			if s.ID != 0 {
+				if err := saveChat(s); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to save chat: %v\n", err)
+				}
+			}
+			fmt.Fprintln(os.Stderr, "Conversation cleared")
+		case "/model":
+			if arg == "" {
+				fmt.Fprintf(os.Stderr, "Using %s\n", strings.Join(labels, " → "))
+				continue
+			}
+			entry := arg
+			if entry == "default" {
+				entry = ""
+			}
+			next, err := chatChain(config, entry)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				continue
+			}
+			chain, s.Model = next, entry
+			labels = labels[:0]
+			for _, p := range chain {
+				labels = append(labels, providerLabel(p))
+			}
+			fmt.Fprintf(os.Stderr, "Switched to %s\n", strings.Join(labels, " → "))
+		case "/save":
+			reply := s.lastReply()
+			switch {
+			case arg == "":
+				fmt.Fprintln(os.Stderr, "Usage: /save FILE")
+			case reply == "":
+				fmt.Fprintln(os.Stderr, "Nothing to save yet")
+			default:
+				if err := os.WriteFile(arg, []byte(reply+"\n"), 0644); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: failed to write %s: %v\n", arg, err)
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "Wrote last reply to %s\n", arg)
+			}
+		case "/post":
+			reply := s.lastReply()
+			if reply == "" {
+				fmt.Fprintln(os.Stderr, "Nothing to post yet")
+				continue
+			}
+			if err := postChatReply(config, s, reply, *channel, *format, lastModel); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command %s (/help lists them)\n", cmd)
+		}
+	}
+	if s.ID != 0 {
+		fmt.Fprintf(os.Stderr, "Saved as chat #%d; resume with cairn chat --resume %d\n", s.ID, s.ID)
+	}
+	return nil
+}
+
+// postChatReply sends a chat reply to the channel as flow "chat", with that flow's send defaults.
+// The reply is read in format, or the channel's format if that is empty.
+func postChatReply(config *Config, s *chatSession, reply, channel, format, model string) error {
+	format, err := inputFormatFor(config, channel, format)
+	if err != nil {
+		return err
+	}
+	text, err := formatContent(reply, format)
+	if err != nil {
+		return err
+	}
+	flow := config.Flows["chat"]
+	p := outgoingPost{Text: text, Channel: channel, Flow: "chat", Silent: flow.Silent, Protect: flow.Protect,
+		NoPreview: flow.NoPreview, PromptPath: s.PromptPath, Model: model}
+	_, err = sendPost(config, &p)
+	return err
+}
@@ -15,6 +15,14 @@ type Config struct {
 	OpenRouter OpenRouterConfig `toml:"openrouter"`
 	OpenAI     OpenAIConfig     `toml:"openai"`
 	Google     GoogleConfig     `toml:"google"`
+	Images     ImagesConfig     `toml:"images"`
+	Writer     WriterConfig     `toml:"writer"`
+	// Optional: LLM providers for the writer ([providers.NAME]), selected by [writer] provider.
+	Providers map[string]ProviderConfig `toml:"providers"`
+	// Optional: prices per model for cairn usage ([prices."MODEL"]).
+	Prices map[string]PriceConfig `toml:"prices"`
+	// Optional: per-flow settings ([flows.morning], [flows.post], ...).
+	Flows map[string]FlowConfig `toml:"flows"`
 }
 
 // GoogleConfig is the [google] section (Maps Geocoding API key).
@@ -26,6 +34,72 @@ type GoogleConfig struct {
 type TelegramConfig struct {
 	BotToken  string `toml:"bot_token"`
 	ChannelID string `toml:"channel_id"`
+	// Optional: default input format for -p/-f text: "html" (default), "markdown" or "plain".
+	Format string `toml:"format"`
+	// Optional: tag appended to every post unless already present (default "#cairn");
+	// shorthand for footer.tags with a single tag.
+	Tag string `toml:"tag"`
+	// Optional: hashtags and signature line added to every post ([telegram.footer]).
+	Footer FooterConfig `toml:"footer"`
+	// Optional: named channel profiles ([telegram.channels.NAME]) selected with --channel NAME.
+	Channels map[string]ChannelConfig `toml:"channels"`
+	// Optional: Bot API server (default "https://api.telegram.org"), e.g. a local stand-in for testing.
+	APIURL string `toml:"api_url"`
+	// Optional: request timeouts in seconds (defaults 10 for messages, 60 for file uploads).
+	Timeout       int `toml:"timeout"`
+	UploadTimeout int `toml:"upload_timeout"`
+	// Optional: retries for 429 (flood control) and 5xx responses (default 3; 0 disables),
+	// base backoff in seconds when Telegram gives no retry_after (default 1, doubled per retry),
+	// and the longest single wait in seconds before giving up (default 60).
+	MaxRetries   *int    `toml:"max_retries"`
+	RetryBackoff float64 `toml:"retry_backoff"`
+	MaxRetryWait int     `toml:"max_retry_wait"`
+}
+
+// ChannelConfig is a [telegram.channels.NAME] profile. Anything left out is taken from [telegram].
+type ChannelConfig struct {
+	ChannelID string `toml:"channel_id"`
+	// Optional: bot token for this channel (default [telegram] bot_token).
+	BotToken string `toml:"bot_token"`
+	// Optional: tag appended to posts in this channel (default [telegram] tag).
+	Tag string `toml:"tag"`
+	// Optional: footer for this channel ([telegram.channels.NAME.footer]); keys left out are inherited.
+	Footer FooterConfig `toml:"footer"`
+	// Optional: input format for -p/-f text in this channel (default [telegram] format).
+	Format string `toml:"format"`
+}
+
+// FooterConfig is what cairn adds to the end of a post. It can be set in [telegram.footer],
+// [telegram.channels.NAME.footer] and [flows.NAME.footer]; each key set in a more specific section wins.
+type FooterConfig struct {
+	// Optional: hashtags appended unless the post already has them (default ["#cairn"]; [] for none).
+	Tags []string `toml:"tags"`
+	// Optional: line added below the tags, e.g. "<i>— Yet</i>" (HTML).
+	Signature string `toml:"signature"`
+	// Optional: add no footer at all (a more specific section can set it back to false).
+	Disable *bool `toml:"disable"`
+}
+
+// FlowConfig is a [flows.NAME] section for one kind of post: post, photo, morning, update, writer or chat.
+type FlowConfig struct {
+	// Optional: footer for this flow, e.g. tags = ["#sleep"] for morning.
+	Footer FooterConfig `toml:"footer"`
+	// Optional: send without notification, protect from forwarding and saving, and disable link
+	// previews for this flow by default (--silent, --protect and --no-preview override them).
+	Silent    bool `toml:"silent"`
+	Protect   bool `toml:"protect"`
+	NoPreview bool `toml:"no_preview"`
+}
+
+// ImagesConfig is the [images] section: optional processing of photos before upload.
+type ImagesConfig struct {
+	// Optional: apply EXIF orientation, downscale and re-encode JPEG/PNG photos, dropping all
+	// metadata including GPS location (default false; files sent with --as document are never touched).
+	Enabled bool `toml:"enabled"`
+	// Optional: longest edge in pixels (default 2560).
+	MaxEdge int `toml:"max_edge"`
+	// Optional: JPEG quality 1-100 (default 87; lowered automatically if the result exceeds 10 MB).
+	Quality int `toml:"quality"`
 }
 
 // FitbitConfig is the [fitbit] section.
@@ -50,6 +124,56 @@ type OpenAIConfig struct {
 	Model  string `toml:"model"`
 }
 
+// WriterConfig is the [writer] section.
+type WriterConfig struct {
+	// Optional: name of the [providers.NAME] section to use (default: [openai], else [openrouter]).
+	Provider string `toml:"provider"`
+	// Optional: ordered fallback chain instead of provider; entries are "NAME" or "NAME:MODEL"
+	// (e.g. "openrouter:google/gemma-2-9b-it:free"). On 429, 5xx, timeouts or empty content the
+	// next entry is tried.
+	Providers []string `toml:"providers"`
+	// Optional: retries of each entry before moving on (default 1; 0 disables), base backoff in
+	// seconds when the API gives no Retry-After (default 2, doubled per retry), and the longest
+	// single wait in seconds (default 60; longer waits skip to the next entry).
+	MaxRetries   *int    `toml:"max_retries"`
+	RetryBackoff float64 `toml:"retry_backoff"`
+	MaxRetryWait int     `toml:"max_retry_wait"`
+}
+
+// ProviderConfig is a [providers.NAME] section: one LLM API the writer can call.
+type ProviderConfig struct {
+	// Optional: "openai", "openrouter", "openai-compatible", "ollama" or "anthropic" (default: NAME).
+	Type string `toml:"type"`
+	// Optional: API base URL, e.g. "http://localhost:8080/v1" for llama.cpp server (required for
+	// openai-compatible; defaults to the public API for the others and http://localhost:11434 for ollama).
+	BaseURL string `toml:"base_url"`
+	// Optional for openai-compatible and ollama.
+	APIKey string `toml:"api_key"`
+	Model  string `toml:"model"`
+	// Optional: request timeout in seconds (default 600).
+	Timeout int `toml:"timeout"`
+	// Optional: default sampling and output settings for this provider (prompt files override them).
+	GenerationParams
+}
+
+// GenerationParams are sampling and output settings for LLM requests, set in [providers.NAME]
+// and in prompt files. Unset fields are left to the API's defaults.
+type GenerationParams struct {
+	Temperature *float64 `toml:"temperature" yaml:"temperature"`
+	TopP        *float64 `toml:"top_p" yaml:"top_p"`
+	MaxTokens   *int     `toml:"max_tokens" yaml:"max_tokens"`
+	Stop        []string `toml:"stop" yaml:"stop"`
+	Seed        *int64   `toml:"seed" yaml:"seed"`
+	// "text" (default) or "json" for JSON mode.
+	ResponseFormat string `toml:"response_format" yaml:"response_format"`
+}
+
+// PriceConfig is a [prices."MODEL"] entry: what a model costs in dollars per million tokens.
+type PriceConfig struct {
+	Input  float64 `toml:"input"`
+	Output float64 `toml:"output"`
+}
+
 func loadConfig(configPath string) (*Config, error) {
 	expandedPath := configPath
 	if len(configPath) > 0 && configPath[0] == '~' {
@@ -82,13 +206,48 @@ func loadConfig(configPath string) (*Config, error) {
 
 // requireTelegram returns an error if Telegram posting credentials are missing.
 func requireTelegram(config *Config) error {
-	if config.Telegram.BotToken == "" {
-		return fmt.Errorf("'bot_token' not found in config file")
+	_, err := channelConfig(config, "")
+	return err
+}
+
+// channelConfig returns the [telegram] settings with the named channel profile applied.
+// An empty name, or "default" when no profile has that name, selects the channel in [telegram] itself.
+func channelConfig(config *Config, name string) (TelegramConfig, error) {
+	tg := config.Telegram
+	if tg.Tag != "" && tg.Footer.Tags == nil {
+		tg.Footer.Tags = []string{tg.Tag}
+	}
+	if _, ok := config.Telegram.Channels[name]; !ok && name == "default" {
+		name = ""
+	}
+	if name != "" {
+		ch, ok := config.Telegram.Channels[name]
+		if !ok {
+			return tg, fmt.Errorf("unknown channel %q (add a [telegram.channels.%s] section to the config file)", name, name)
+		}
+		if ch.ChannelID == "" {
+			return tg, fmt.Errorf("'channel_id' not found in [telegram.channels.%s]", name)
+		}
+		tg.ChannelID = ch.ChannelID
+		if ch.BotToken != "" {
+			tg.BotToken = ch.BotToken
+		}
+		footer := ch.Footer
+		if ch.Tag != "" && footer.Tags == nil {
+			footer.Tags = []string{ch.Tag}
+		}
+		tg.Footer = tg.Footer.override(footer)
+		if ch.Format != "" {
+			tg.Format = ch.Format
+		}
+	}
+	if tg.BotToken == "" {
+		return tg, fmt.Errorf("'bot_token' not found in config file")
 	}
-	if config.Telegram.ChannelID == "" {
-		return fmt.Errorf("'channel_id' not found in config file")
+	if tg.ChannelID == "" {
+		return tg, fmt.Errorf("'channel_id' not found in config file")
 	}
-	return nil
+	return tg, nil
 }
 
 func readFileContent(filePath string) (string, error) {
@@ -436,8 +436,9 @@ func formatSleepData(sleepResp *FitbitSleepResponse) string {
 	return b.String()
 }
 
-// Morning runs the morning flow: get Fitbit sleep data and post to Telegram.
-func Morning(config *Config, additionalText string) error {
+// Morning runs the morning flow: get Fitbit sleep data and post to Telegram. post carries the
+// channel and send options; its text and flow are filled in here.
+func Morning(config *Config, additionalText string, post outgoingPost) error {
 	if config.Fitbit.ClientID == "" {
 		return fmt.Errorf("'fitbit.client_id' not found in config file")
 	}
@@ -479,7 +480,8 @@ func Morning(config *Config, additionalText string) error {
 	if additionalText != "" {
 		sleepMessage = sleepMessage + "\n\n" + strings.TrimSpace(additionalText)
 	}
-	if _, err := postToTelegram(config.Telegram.BotToken, config.Telegram.ChannelID, sleepMessage); err != nil {
+	post.Text, post.Flow = sleepMessage, "morning"
+	if _, err := sendPost(config, &post); err != nil {
 		return fmt.Errorf("failed to post to Telegram: %w", err)
 	}
 	return nil
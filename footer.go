@@ -0,0 +1,74 @@
+package main
+
+import "strings"
+
+// defaultTag is the footer when no [telegram], channel or flow section configures one.
+const defaultTag = "#cairn"
+
+// override returns f with every key that o sets replaced by o's value.
+func (f FooterConfig) override(o FooterConfig) FooterConfig {
+	if o.Tags != nil {
+		f.Tags = o.Tags
+	}
+	if o.Signature != "" {
+		f.Signature = o.Signature
+	}
+	if o.Disable != nil {
+		f.Disable = o.Disable
+	}
+	return f
+}
+
+// footerFor resolves the footer for a post in flow to the channel described by tg:
+// [telegram.footer], then the channel profile (already merged into tg), then [flows.NAME.footer].
+func footerFor(config *Config, tg TelegramConfig, flow string) FooterConfig {
+	f := tg.Footer.override(config.Flows[flow].Footer)
+	if f.Tags == nil {
+		f.Tags = []string{defaultTag}
+	}
+	return f
+}
+
+// applyFooter appends the footer's tags that content does not already have, on the last line as
+// before, followed by the signature line.
+func applyFooter(content string, f FooterConfig) string {
+	if f.Disable != nil && *f.Disable {
+		return content
+	}
+	content = appendTags(content, f.Tags)
+	signature := strings.TrimSpace(f.Signature)
+	if signature == "" || strings.Contains(content, signature) {
+		return content
+	}
+	content = strings.TrimRight(content, " \n\t")
+	if content != "" {
+		content += "\n"
+	}
+	return content + signature
+}
+
+// appendTags appends the tags that content does not already have to its last line. Tags are
+// matched as whole hashtags, so #cairnfoo is not #cairn; a missing "#" is added.
+func appendTags(content string, tags []string) string {
+	var missing []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if !strings.HasPrefix(tag, "#") {
+			tag = "#" + tag
+		}
+		if !hasTag(content, tag) && !hasTag(strings.Join(missing, " "), tag) {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) == 0 {
+		return content
+	}
+	content = strings.TrimRight(content, " \n\t")
+	if content != "" {
+		content += " "
+	}
+	return content + strings.Join(missing, " ")
+}
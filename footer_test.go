@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestHasTag(t *testing.T) {
+	tests := []struct {
+		text, tag string
+		want      bool
+	}{
+		{"Morning run #cairn", "#cairn", true},
+		{"Morning run #Cairn", "cairn", true},
+		{"#cairn at the start", "#cairn", true},
+		{"(#cairn)", "#cairn", true},
+		{"Morning run #cairnfoo", "#cairn", false},
+		{"Morning run #cairn_2", "#cairn", false},
+		{"Morning run ##cairn", "#cairn", false},
+		{"word#cairn", "#cairn", false},
+		{"no tags", "#cairn", false},
+		{"#cairn", "#", false},
+	}
+	for _, tt := range tests {
+		if got := hasTag(tt.text, tt.tag); got != tt.want {
+			t.Errorf("hasTag(%q, %q) = %v, want %v", tt.text, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestAppendTags(t *testing.T) {
+	tests := []struct {
+		content string
+		tags    []string
+		want    string
+	}{
+		{"Hello", []string{"#cairn"}, "Hello #cairn"},
+		{"Hello #cairn", []string{"#cairn"}, "Hello #cairn"},
+		{"Hello #cairnfoo", []string{"#cairn"}, "Hello #cairnfoo #cairn"},
+		{"Hello\n\n", []string{"travel", "#travel", " "}, "Hello #travel"},
+		{"", []string{"#cairn"}, "#cairn"},
+	}
+	for _, tt := range tests {
+		if got := appendTags(tt.content, tt.tags); got != tt.want {
+			t.Errorf("appendTags(%q, %q) = %q, want %q", tt.content, tt.tags, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Input formats for post content; Telegram always receives HTML.
+const (
+	formatHTML     = "html"
+	formatMarkdown = "markdown"
+	formatPlain    = "plain"
+)
+
+// formatContent converts text in the given input format to the HTML subset Telegram accepts.
+// An empty format means HTML, which is passed through unchanged as before.
+func formatContent(text, format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", formatHTML:
+		return text, nil
+	case formatPlain, "text":
+		return escapeHTML(text), nil
+	case formatMarkdown, "md":
+		return markdownToHTML(text), nil
+	default:
+		return "", fmt.Errorf("unknown format %q (use markdown, html or plain)", format)
+	}
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeHTML escapes the characters Telegram's HTML parser treats specially.
+func escapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+var (
+	mdFenceRe   = regexp.MustCompile("^\\s*(```|~~~)\\s*([A-Za-z0-9_+-]*)\\s*$")
+	mdHeadingRe = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*\s*$`)
+	mdListRe    = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdQuoteRe   = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	mdRuleRe    = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+
+	mdCodeRe     = regexp.MustCompile("`([^`\n]+)`")
+	mdLinkRe     = regexp.MustCompile(`\[([^\]\n]+)\]\(([^)\s]+)\)`)
+	mdBoldRe     = regexp.MustCompile(`\*\*([^*\n]+?)\*\*|__([^_\n]+?)__`)
+	mdStrikeRe   = regexp.MustCompile(`~~([^~\n]+?)~~`)
+	mdSpoilerRe  = regexp.MustCompile(`\|\|([^|\n]+?)\|\|`)
+	mdItalicRe   = regexp.MustCompile(`\*([^*\s][^*\n]*?)\*`)
+	mdUnderRe    = regexp.MustCompile(`(^|[^\p{L}\p{N}_])_([^_\s][^_\n]*?)_($|[^\p{L}\p{N}_])`)
+	mdHolderRe   = regexp.MustCompile("\x00([0-9]+)\x00")
+	mdQuoteAttrs = strings.NewReplacer(`"`, "&quot;")
+)
+
+// markdownToHTML converts common Markdown to Telegram HTML: bold, italic, strikethrough, inline code,
+// fenced code blocks (pre), links, blockquotes and ||spoilers||. Headings become bold lines and list
+// bullets become "•"; everything else is escaped so stray < or & cannot break the post.
+func markdownToHTML(md string) string {
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if m := mdFenceRe.FindStringSubmatch(line); m != nil {
+			var code []string
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != m[1]; i++ {
+				code = append(code, lines[i])
+			}
+			body := escapeHTML(strings.Join(code, "\n"))
+			if m[2] != "" {
+				out = append(out, `<pre><code class="language-`+m[2]+`">`+body+`</code></pre>`)
+			} else {
+				out = append(out, "<pre>"+body+"</pre>")
+			}
+			continue
+		}
+		if mdQuoteRe.MatchString(line) {
+			var quote []string
+			for ; i < len(lines) && mdQuoteRe.MatchString(lines[i]); i++ {
+				quote = append(quote, markdownInline(mdQuoteRe.FindStringSubmatch(lines[i])[1]))
+			}
+			i--
+			out = append(out, "<blockquote>"+strings.Join(quote, "\n")+"</blockquote>")
+			continue
+		}
+		switch {
+		case mdHeadingRe.MatchString(line):
+			out = append(out, "<b>"+markdownInline(mdHeadingRe.FindStringSubmatch(line)[1])+"</b>")
+		case mdRuleRe.MatchString(line):
+			out = append(out, "──────────")
+		case mdListRe.MatchString(line):
+			m := mdListRe.FindStringSubmatch(line)
+			out = append(out, m[1]+"• "+markdownInline(m[2]))
+		default:
+			out = append(out, markdownInline(line))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// markdownInline converts inline Markdown in one line. Code spans and links are swapped for
+// placeholders first so that their contents are not reinterpreted as emphasis.
+func markdownInline(s string) string {
+	var held []string
+	hold := func(html string) string {
+		held = append(held, html)
+		return "\x00" + strconv.Itoa(len(held)-1) + "\x00"
+	}
+	expand := func(s string) string {
+		return mdHolderRe.ReplaceAllStringFunc(s, func(m string) string {
+			n, _ := strconv.Atoi(mdHolderRe.FindStringSubmatch(m)[1])
+			return held[n]
+		})
+	}
+	s = mdCodeRe.ReplaceAllStringFunc(s, func(m string) string {
+		return hold("<code>" + escapeHTML(mdCodeRe.FindStringSubmatch(m)[1]) + "</code>")
+	})
+	// Link text may hold code spans, which are expanded before the link itself is held.
+	s = mdLinkRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := mdLinkRe.FindStringSubmatch(m)
+		href := mdQuoteAttrs.Replace(escapeHTML(sub[2]))
+		return hold(`<a href="` + href + `">` + expand(markdownEmphasis(escapeHTML(sub[1]))) + "</a>")
+	})
+	return expand(markdownEmphasis(escapeHTML(s)))
+}
+
+func markdownEmphasis(s string) string {
+	s = mdBoldRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := mdBoldRe.FindStringSubmatch(m)
+		return "<b>" + sub[1] + sub[2] + "</b>"
+	})
+	s = mdStrikeRe.ReplaceAllString(s, "<s>$1</s>")
+	s = mdSpoilerRe.ReplaceAllString(s, "<tg-spoiler>$1</tg-spoiler>")
+	s = mdItalicRe.ReplaceAllString(s, "<i>$1</i>")
+	// mdUnderRe consumes the character after an italic, which may start the next one ("_a_ _b_"),
+	// so repeat until nothing changes.
+	for {
+		next := mdUnderRe.ReplaceAllString(s, "$1<i>$2</i>$3")
+		if next == s {
+			return s
+		}
+		s = next
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", "hello world", "hello world"},
+		{"bold and italic", "**bold**, __also bold__, *it* and _it_", "<b>bold</b>, <b>also bold</b>, <i>it</i> and <i>it</i>"},
+		{"strike and spoiler", "~~old~~ ||secret||", "<s>old</s> <tg-spoiler>secret</tg-spoiler>"},
+		{"adjacent underscore italics", "_a_ _b_,_c_", "<i>a</i> <i>b</i>,<i>c</i>"},
+		{"snake_case is left alone", "call my_func_name or other_func", "call my_func_name or other_func"},
+		{"lone asterisks are left alone", "5 * 3 * 2", "5 * 3 * 2"},
+		{"code span is not emphasised", "run `a*b*c` or `x_y_z`", "run <code>a*b*c</code> or <code>x_y_z</code>"},
+		{"code span is escaped", "`<b> & </b>`", "<code>&lt;b&gt; &amp; &lt;/b&gt;</code>"},
+		{"link URL is not emphasised", "[docs](https://example.com/*path*/a_b_)", `<a href="https://example.com/*path*/a_b_">docs</a>`},
+		{"link text keeps emphasis", "[**bold** docs](https://example.com)", `<a href="https://example.com"><b>bold</b> docs</a>`},
+		{"code span in link text", "[`code`](https://x.example) and `more`", `<a href="https://x.example"><code>code</code></a> and <code>more</code>`},
+		{"link URL is escaped", `[q](https://example.com/?a="b"&c=1)`, `<a href="https://example.com/?a=&quot;b&quot;&amp;c=1">q</a>`},
+		{"stray < and & are escaped", "a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{"HTML is escaped", "<b>not bold</b>", "&lt;b&gt;not bold&lt;/b&gt;"},
+		{"heading", "## Day 3 ##", "<b>Day 3</b>"},
+		{"list", "- one\n  * two", "• one\n  • two"},
+		{"rule", "---", "──────────"},
+		{"blockquote", "> one\n> **two**\nafter", "<blockquote>one\n<b>two</b></blockquote>\nafter"},
+		{"blockquote is escaped", "> a < b", "<blockquote>a &lt; b</blockquote>"},
+		{"fence with language", "```go\nif a < b && c {\n\t**x**\n}\n```", "<pre><code class=\"language-go\">if a &lt; b &amp;&amp; c {\n\t**x**\n}</code></pre>"},
+		{"fence without language", "~~~\n> not a quote\n~~~\ntext", "<pre>&gt; not a quote</pre>\ntext"},
+		{"unclosed fence runs to the end", "```\n*x*", "<pre>*x*</pre>"},
+		{"CRLF line endings", "**a**\r\nb", "<b>a</b>\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToHTML(tt.in); got != tt.want {
+				t.Errorf("markdownToHTML(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatContent(t *testing.T) {
+	tests := []struct {
+		format  string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "<b>x</b> & y", "<b>x</b> & y", false},
+		{"html", "<b>x</b>", "<b>x</b>", false},
+		{"plain", "<b>x</b> & *y*", "&lt;b&gt;x&lt;/b&gt; &amp; *y*", false},
+		{"Markdown", "*y*", "<i>y</i>", false},
+		{"rst", "x", "", true},
+	}
+	for _, tt := range tests {
+		got, err := formatContent(tt.in, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("formatContent(%q, %q) error = %v, wantErr %v", tt.in, tt.format, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("formatContent(%q, %q) = %q, want %q", tt.in, tt.format, got, tt.want)
+		}
+	}
+}
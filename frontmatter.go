@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatter holds the posting options a -f file can set in a block at its very top, between
+// "---" lines (YAML) or "+++" lines (TOML). Flags given on the command line take precedence.
+type frontMatter struct {
+	Channel  string   `yaml:"channel" toml:"channel"`
+	Channels []string `yaml:"channels" toml:"channels"`
+	// Photos are media files, relative to the post file's directory unless absolute.
+	Photos []string `yaml:"photos" toml:"photos"`
+	// Silent, Protect and NoPreview override the flow's defaults when set, including to false.
+	Silent    *bool `yaml:"silent" toml:"silent"`
+	Protect   *bool `yaml:"protect" toml:"protect"`
+	NoPreview *bool `yaml:"no_preview" toml:"no_preview"`
+	// At schedules the post, in the same formats as --at.
+	At string `yaml:"at" toml:"at"`
+	// Tags are hashtags added to the post besides the footer.
+	Tags    []string `yaml:"tags" toml:"tags"`
+	ReplyTo int64    `yaml:"reply_to" toml:"reply_to"`
+	Format  string   `yaml:"format" toml:"format"`
+	// Buttons are keyboard rows in --button-row syntax.
+	Buttons []string `yaml:"buttons" toml:"buttons"`
+}
+
+// channels returns the channel profiles named by channel and channels.
+func (fm frontMatter) channels() []string {
+	if fm.Channel == "" {
+		return fm.Channels
+	}
+	return append([]string{fm.Channel}, fm.Channels...)
+}
+
+// readPostFile reads a -f file and splits off its optional front-matter; the rest is the post text.
+// A file without front-matter is returned unchanged, like readFileContent.
+func readPostFile(path string) (string, frontMatter, error) {
+	var fm frontMatter
+	content, err := readFileContent(path)
+	if err != nil {
+		return "", fm, err
+	}
+	block, body, delim, ok := splitFrontMatter(content)
+	if !ok {
+		return content, fm, nil
+	}
+	if err := decodeFrontMatter(block, delim, &fm); err != nil {
+		return "", fm, fmt.Errorf("invalid front-matter in %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	for i, p := range fm.Photos {
+		if p = os.ExpandEnv(strings.TrimSpace(p)); !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		fm.Photos[i] = p
+	}
+	return body, fm, nil
+}
+
+// decodeFrontMatter decodes a block returned by splitFrontMatter into v, as TOML for "+++" and
+// YAML otherwise. Unknown keys are an error; an empty block leaves v unchanged.
+func decodeFrontMatter(block, delim string, v interface{}) error {
+	if delim == "+++" {
+		d := toml.NewDecoder(strings.NewReader(block))
+		d.DisallowUnknownFields()
+		return d.Decode(v)
+	}
+	d := yaml.NewDecoder(strings.NewReader(block))
+	d.KnownFields(true)
+	if err := d.Decode(v); !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// splitFrontMatter separates a leading "---" or "+++" block from the body. ok is false when the
+// content does not start with a delimiter line, the block is never closed, or a "---" block is
+// not a YAML mapping: Markdown may open with a "---" rule and have another one further down.
+func splitFrontMatter(content string) (block, body, delim string, ok bool) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) == 0 {
+		return "", content, "", false
+	}
+	delim = strings.TrimSpace(lines[0])
+	if delim != "---" && delim != "+++" {
+		return "", content, "", false
+	}
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == delim {
+			block = strings.Join(lines[1:i], "")
+			if delim == "---" && !isYAMLMapping(block) {
+				break
+			}
+			body = strings.TrimLeft(strings.Join(lines[i+1:], ""), "\r\n")
+			return block, body, delim, true
+		}
+	}
+	return "", content, "", false
+}
+
+// isYAMLMapping reports whether block parses as a YAML mapping, or is empty.
+func isYAMLMapping(block string) bool {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(block), &doc); err != nil {
+		return false
+	}
+	return len(doc.Content) == 0 || doc.Content[0].Kind == yaml.MappingNode
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	_ "modernc.org/sqlite"
+)
+
+// historyTimeLayout is how created_at is stored (local time, sortable as text).
+const historyTimeLayout = "2006-01-02 15:04:05"
+
+// postRecord is one sent or edited Telegram message (or media group) in the history DB.
+type postRecord struct {
+	ID           int64
+	ChatID       string
+	MessageIDs   []int64
+	MediaGroupID string // comma-separated when a post spans several albums
+	Action       string // "send" or "edit"
+	Text         string
+	Photos       []string
+	Flow         string // e.g. "post", "photo", "morning", "update", "writer"
+	// Buttons are the inline keyboard of the last message, kept so edits can send them again.
+	Buttons [][]inlineButton
+	// PromptPath and Model are set for writer posts: the prompt file and the LLM that generated the text.
+	PromptPath string
+	Model      string
+	CreatedAt  string
+}
+
+// historyDBPath returns the path to the local SQLite DB for sent Telegram messages.
+func historyDBPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cairn_history.db"), nil
+}
+
+// historySchema creates the tables in the history DB. message_ids columns are stored as ",1,2,3,"
+// so any single ID can be matched with LIKE '%,id,%'.
+var historySchema = []string{
+	`CREATE TABLE IF NOT EXISTS posts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id TEXT NOT NULL,
+		message_id INTEGER NOT NULL,
+		message_ids TEXT NOT NULL,
+		media_group_id TEXT,
+		action TEXT NOT NULL,
+		text TEXT,
+		photos TEXT,
+		flow TEXT,
+		created_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS scheduled (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		due_at TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		message_ids TEXT,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS chats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		prompt_path TEXT,
+		model TEXT,
+		base_messages INTEGER NOT NULL DEFAULT 0,
+		messages TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS llm_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		source TEXT,
+		prompt_tokens INTEGER NOT NULL,
+		completion_tokens INTEGER NOT NULL,
+		created_at TEXT NOT NULL
+	)`,
+}
+
+// historyColumns are columns added after their table was first released; migrateHistoryDB adds
+// those that a database created by an older version lacks.
+var historyColumns = []struct{ table, column, decl string }{
+	{"posts", "prompt_path", "TEXT"},
+	{"posts", "model", "TEXT"},
+	{"posts", "buttons", "TEXT"},
+}
+
+// migrateHistoryDB adds the missing historyColumns, checking PRAGMA table_info for what exists.
+func migrateHistoryDB(db *sql.DB) error {
+	existing := map[string]map[string]bool{}
+	for _, c := range historyColumns {
+		cols, ok := existing[c.table]
+		if !ok {
+			var err error
+			if cols, err = tableColumns(db, c.table); err != nil {
+				return err
+			}
+			existing[c.table] = cols
+		}
+		if cols[c.column] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE ` + c.table + ` ADD COLUMN ` + c.column + ` ` + c.decl); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", c.table, c.column, err)
+		}
+		cols[c.column] = true
+	}
+	return nil
+}
+
+// tableColumns returns the column names of table.
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols[name] = true
+	}
+	return cols, rows.Err()
+}
+
+// historySetup creates and migrates the history DB once per process; later opens reuse its result.
+var historySetup struct {
+	once sync.Once
+	err  error
+}
+
+// initHistoryDB opens the history DB. Connections wait up to 5s for a lock held by another
+// writer, such as a running daemon or parallel batch jobs, instead of failing with SQLITE_BUSY.
+func initHistoryDB() (*sql.DB, error) {
+	p, err := historyDBPath()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", p+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	historySetup.once.Do(func() { historySetup.err = setupHistoryDB(db) })
+	if historySetup.err != nil {
+		db.Close()
+		return nil, historySetup.err
+	}
+	return db, nil
+}
+
+// setupHistoryDB creates missing tables and adds missing columns.
+func setupHistoryDB(db *sql.DB) error {
+	for _, stmt := range historySchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return migrateHistoryDB(db)
+}
+
+func joinMessageIDs(ids []int64) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return "," + strings.Join(parts, ",") + ","
+}
+
+// formatMessageIDs renders IDs for display, e.g. "101, 102".
+func formatMessageIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// summarizeMessageIDs is formatMessageIDs shortened for tables, e.g. "100 … 124 (25)".
+func summarizeMessageIDs(ids []int64) string {
+	if len(ids) <= 4 {
+		return formatMessageIDs(ids)
+	}
+	return fmt.Sprintf("%d … %d (%d)", ids[0], ids[len(ids)-1], len(ids))
+}
+
+func splitMessageIDs(s string) []int64 {
+	var ids []int64
+	for _, p := range strings.Split(strings.Trim(s, ","), ",") {
+		if id, err := strconv.ParseInt(p, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// recordPost saves rec to the history DB. Failures are reported on stderr but never fail the post itself.
+func recordPost(rec postRecord) {
+	if len(rec.MessageIDs) == 0 {
+		return
+	}
+	db, err := initHistoryDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to open history DB: %v\n", err)
+		return
+	}
+	defer db.Close()
+	if rec.CreatedAt == "" {
+		rec.CreatedAt = time.Now().Format(historyTimeLayout)
+	}
+	var buttons string
+	if len(rec.Buttons) > 0 {
+		b, _ := json.Marshal(rec.Buttons)
+		buttons = string(b)
+	}
+	_, err = db.Exec(`INSERT INTO posts (chat_id, message_id, message_ids, media_group_id, action, text, photos, flow, prompt_path, model, buttons, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ChatID, rec.MessageIDs[0], joinMessageIDs(rec.MessageIDs), rec.MediaGroupID, rec.Action,
+		rec.Text, strings.Join(rec.Photos, "\n"), rec.Flow, rec.PromptPath, rec.Model, buttons, rec.CreatedAt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record post in history: %v\n", err)
+	}
+}
+
+// recordedButtons returns the inline keyboard that messageID in chatID last had according to
+// history: from its latest edit, or from the send that made it the last message of a post.
+// It returns nil when history has none.
+func recordedButtons(chatID string, messageID int64) ([][]inlineButton, error) {
+	db, err := initHistoryDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer db.Close()
+	var ids, buttons string
+	err = db.QueryRow(`SELECT message_ids, COALESCE(buttons, '') FROM posts
+		WHERE chat_id = ? AND action IN ('send', 'edit') AND message_ids LIKE ?
+		ORDER BY id DESC LIMIT 1`, chatID, "%,"+strconv.FormatInt(messageID, 10)+",%").Scan(&ids, &buttons)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Buttons go on the last message of a post; the others never had any.
+	if list := splitMessageIDs(ids); buttons == "" || list[len(list)-1] != messageID {
+		return nil, nil
+	}
+	var rows [][]inlineButton
+	if err := json.Unmarshal([]byte(buttons), &rows); err != nil {
+		return nil, fmt.Errorf("bad buttons recorded for message %d: %w", messageID, err)
+	}
+	return rows, nil
+}
+
+// albumMessageIDs looks up the album that messageID belongs to in the recorded sends to chatID and
+// returns all of its message IDs. A post with more than 10 files was sent as consecutive albums,
+// so the album is found by replaying albumSizes over the recorded IDs.
+func albumMessageIDs(chatID string, messageID int64) ([]int64, error) {
+	db, err := initHistoryDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer db.Close()
+	var ids, photos string
+	err = db.QueryRow(`SELECT message_ids, COALESCE(photos, '') FROM posts
+		WHERE chat_id = ? AND action = 'send' AND COALESCE(media_group_id, '') != '' AND message_ids LIKE ?
+		ORDER BY id DESC LIMIT 1`, chatID, "%,"+strconv.FormatInt(messageID, 10)+",%").Scan(&ids, &photos)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("message %d is not part of an album recorded in history for %s", messageID, chatID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	all := splitMessageIDs(ids)
+	start := 0
+	for _, size := range albumSizes(len(strings.Split(photos, "\n"))) {
+		if start+size > len(all) {
+			break
+		}
+		for _, id := range all[start : start+size] {
+			if id == messageID {
+				return all[start : start+size], nil
+			}
+		}
+		start += size
+	}
+	return nil, fmt.Errorf("message %d is a text message sent after an album, not part of it", messageID)
+}
+
+// latestFlowMessage returns the first message ID of the most recent post sent to chatID by flow
+// since the start of today, e.g. today's morning post to reply to.
+func latestFlowMessage(chatID, flow string) (int64, error) {
+	db, err := initHistoryDB()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer db.Close()
+	today := time.Now().Format("2006-01-02")
+	var id int64
+	err = db.QueryRow(`SELECT message_id FROM posts WHERE chat_id = ? AND flow = ? AND action = 'send' AND created_at >= ?
+		ORDER BY id DESC LIMIT 1`, chatID, flow, today).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("no %s post was sent to %s today, nothing to reply to", flow, chatID)
+	}
+	return id, err
+}
+
+// historyFilter narrows the history listing; empty fields match everything.
+type historyFilter struct {
+	Text  string
+	Tag   string
+	Flow  string
+	Since string // inclusive, historyTimeLayout prefix
+	Until string // exclusive, historyTimeLayout prefix
+	Limit int
+}
+
+func queryHistory(f historyFilter) ([]postRecord, error) {
+	db, err := initHistoryDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	query := `SELECT id, chat_id, message_ids, COALESCE(media_group_id, ''), action, COALESCE(text, ''), COALESCE(photos, ''), COALESCE(flow, ''), COALESCE(prompt_path, ''), COALESCE(model, ''), created_at FROM posts WHERE 1=1`
+	var args []interface{}
+	if f.Text != "" {
+		query += ` AND text LIKE ?`
+		args = append(args, "%"+f.Text+"%")
+	}
+	if f.Tag != "" {
+		// Coarse match in SQL; hasTag below rejects prefixes such as #cairnfoo for #cairn.
+		query += ` AND text LIKE ?`
+		args = append(args, "%"+f.Tag+"%")
+	}
+	if f.Flow != "" {
+		query += ` AND flow = ?`
+		args = append(args, f.Flow)
+	}
+	if f.Since != "" {
+		query += ` AND created_at >= ?`
+		args = append(args, f.Since)
+	}
+	if f.Until != "" {
+		query += ` AND created_at < ?`
+		args = append(args, f.Until)
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []postRecord
+	for rows.Next() {
+		var rec postRecord
+		var ids, photos string
+		if err := rows.Scan(&rec.ID, &rec.ChatID, &ids, &rec.MediaGroupID, &rec.Action, &rec.Text, &photos, &rec.Flow, &rec.PromptPath, &rec.Model, &rec.CreatedAt); err != nil {
+			return nil, err
+		}
+		if f.Tag != "" && !hasTag(rec.Text, f.Tag) {
+			continue
+		}
+		rec.MessageIDs = splitMessageIDs(ids)
+		if photos != "" {
+			rec.Photos = strings.Split(photos, "\n")
+		}
+		out = append(out, rec)
+		if f.Limit > 0 && len(out) >= f.Limit {
+			break
+		}
+	}
+	return out, rows.Err()
+}
+
+// hasTag reports whether text contains tag as a whole hashtag (case-insensitive), so #cairnfoo does not match #cairn.
+func hasTag(text, tag string) bool {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	if tag == "" {
+		return false
+	}
+	re := regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}_#])#` + regexp.QuoteMeta(tag) + `($|[^\p{L}\p{N}_])`)
+	return re.MatchString(text)
+}
+
+// parseHistoryDate accepts "2006-01-02" or "2006-01-02 15:04" and returns it in historyTimeLayout.
+// With endOfDay, a bare date is moved to the start of the following day (for exclusive upper bounds).
+func parseHistoryDate(s string, endOfDay bool) (string, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t.Format(historyTimeLayout), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q (use YYYY-MM-DD or \"YYYY-MM-DD HH:MM\")", s)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.Format(historyTimeLayout), nil
+}
+
+var whitespaceRe = regexp.MustCompile(`\s+`)
+
+// historySnippet flattens text to one line of at most n runes for the listing.
+func historySnippet(text string, n int) string {
+	s := strings.TrimSpace(whitespaceRe.ReplaceAllString(text, " "))
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// History runs "cairn history": list recorded Telegram posts, newest first.
+func History(args []string) error {
+	fs := pflag.NewFlagSet("history", pflag.ContinueOnError)
+	search := fs.StringP("search", "s", "", "Only posts whose text contains this string")
+	tag := fs.StringP("tag", "t", "", "Only posts with this hashtag (e.g. sleep or #sleep)")
+	flow := fs.String("flow", "", "Only posts from this flow (post, photo, morning, update)")
+	since := fs.String("since", "", "Only posts on or after this date (YYYY-MM-DD or \"YYYY-MM-DD HH:MM\")")
+	until := fs.String("until", "", "Only posts on or before this date (YYYY-MM-DD or \"YYYY-MM-DD HH:MM\")")
+	limit := fs.IntP("limit", "n", 20, "Maximum number of posts to show (0 for all)")
+	full := fs.Bool("full", false, "Print full text instead of a one-line snippet")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f := historyFilter{Text: *search, Tag: *tag, Flow: *flow, Limit: *limit}
+	var err error
+	if *since != "" {
+		if f.Since, err = parseHistoryDate(*since, false); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if f.Until, err = parseHistoryDate(*until, true); err != nil {
+			return err
+		}
+	}
+	records, err := queryHistory(f)
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	if len(records) == 0 {
+		fmt.Fprintln(os.Stderr, "No matching posts in history")
+		return nil
+	}
+	if *full {
+		for _, rec := range records {
+			fmt.Fprintf(os.Stdout, "%s  %s  %s  %s\n", rec.CreatedAt, rec.Flow, rec.Action, formatMessageIDs(rec.MessageIDs))
+			if rec.PromptPath != "" || rec.Model != "" {
+				fmt.Fprintf(os.Stdout, "prompt: %s  model: %s\n", rec.PromptPath, rec.Model)
+			}
+			fmt.Fprintf(os.Stdout, "%s\n\n", rec.Text)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tFLOW\tACTION\tMESSAGE IDS\tTEXT")
+	for _, rec := range records {
+		text := historySnippet(rec.Text, 60)
+		if len(rec.Photos) > 0 {
+			text = fmt.Sprintf("[%d file(s)] %s", len(rec.Photos), text)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", rec.CreatedAt, rec.Flow, rec.Action, summarizeMessageIDs(rec.MessageIDs), text)
+	}
+	return tw.Flush()
+}
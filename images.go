@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Defaults for the [images] section.
+const (
+	defaultImageMaxEdge = 2560
+	defaultImageQuality = 87
+	// telegramPhotoLimit is the largest file Telegram accepts through sendPhoto.
+	telegramPhotoLimit = 10 << 20
+	// minImageQuality is as far as quality is lowered to get a photo under telegramPhotoLimit.
+	minImageQuality = 50
+)
+
+// prepareImages processes the photos among paths according to cfg and returns the paths to upload,
+// with processed photos replaced by temporary files. cleanup removes those files and must always be called.
+// Only JPEG and PNG files sent as photos are touched; documents keep their original bytes.
+func prepareImages(cfg ImagesConfig, paths, types []string) (out []string, cleanup func(), err error) {
+	var temps []string
+	cleanup = func() {
+		for _, t := range temps {
+			os.Remove(t)
+		}
+	}
+	out = append([]string(nil), paths...)
+	if !cfg.Enabled {
+		return out, cleanup, nil
+	}
+	for i, p := range paths {
+		if types[i] != mediaPhoto {
+			continue
+		}
+		processed, err := processImage(cfg, p)
+		if err != nil {
+			cleanup()
+			return nil, func() {}, fmt.Errorf("failed to process %s: %w", filepath.Base(p), err)
+		}
+		if processed != "" {
+			temps = append(temps, processed)
+			out[i] = processed
+		}
+	}
+	return out, cleanup, nil
+}
+
+// processImage applies the EXIF orientation, downscales to cfg.MaxEdge and re-encodes path into a
+// temporary file, which drops all metadata (including GPS location). It returns "" for formats it
+// does not handle, which are uploaded unchanged.
+func processImage(cfg ImagesConfig, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if err == image.ErrFormat {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	maxEdge := cfg.MaxEdge
+	if maxEdge <= 0 {
+		maxEdge = defaultImageMaxEdge
+	}
+	img = downscale(img, maxEdge)
+
+	ext := strings.ToLower(filepath.Ext(path))
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		if err := encodeJPEG(&buf, img, cfg.Quality); err != nil {
+			return "", err
+		}
+	case "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return "", fmt.Errorf("failed to encode PNG: %w", err)
+		}
+		// A photo saved as PNG can be far larger than Telegram accepts; send it as JPEG instead.
+		if buf.Len() > telegramPhotoLimit {
+			if err := encodeJPEG(&buf, flattenAlpha(img), cfg.Quality); err != nil {
+				return "", err
+			}
+			ext = ".jpg"
+		}
+	default:
+		return "", nil
+	}
+	if buf.Len() > telegramPhotoLimit {
+		return "", fmt.Errorf("re-encoded photo is %d bytes, over Telegram's %d MB limit; lower max_edge or send it with --as document",
+			buf.Len(), telegramPhotoLimit>>20)
+	}
+
+	f, err := os.CreateTemp("", "cairn-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// encodeJPEG encodes img into buf at quality (defaultImageQuality if unset), lowering it in steps
+// down to minImageQuality while the result exceeds telegramPhotoLimit.
+func encodeJPEG(buf *bytes.Buffer, img image.Image, quality int) error {
+	if quality <= 0 || quality > 100 {
+		quality = defaultImageQuality
+	}
+	for {
+		buf.Reset()
+		if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return fmt.Errorf("failed to encode JPEG: %w", err)
+		}
+		if buf.Len() <= telegramPhotoLimit || quality <= minImageQuality {
+			return nil
+		}
+		quality -= 10
+		if quality < minImageQuality {
+			quality = minImageQuality
+		}
+	}
+}
+
+// flattenAlpha draws img over a white background, so transparent areas do not turn black in JPEG.
+func flattenAlpha(img image.Image) image.Image {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG file, or 1 if it has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return 1 // start of image data: no EXIF before it
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation reads the Orientation tag (0x0112) from IFD0 of a TIFF-formatted EXIF block.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates and flips img so that it displays upright without the EXIF orientation tag.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			si, di := src.PixOffset(x, y), dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// downscale shrinks img so that its longest edge is at most maxEdge, averaging the source pixels
+// covered by each output pixel. Smaller images are returned unchanged.
+func downscale(img image.Image, maxEdge int) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= maxEdge && h <= maxEdge {
+		return img
+	}
+	dw, dh := maxEdge, h*maxEdge/w
+	if h > w {
+		dw, dh = w*maxEdge/h, maxEdge
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	src := toRGBA(img)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, (y+1)*h/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, (x+1)*w/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[row+c])
+					}
+					row += 4
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			di := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[di+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// toRGBA returns img as an *image.RGBA whose bounds start at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
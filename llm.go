@@ -0,0 +1,693 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	openRouterURL = "https://openrouter.ai/api/v1/chat/completions"
+	openAIURL     = "https://api.openai.com/v1/chat/completions"
+
+	defaultOllamaURL     = "http://localhost:11434"
+	defaultAnthropicURL  = "https://api.anthropic.com"
+	anthropicVersion     = "2023-06-01"
+	defaultAnthropicMax  = 4096
+	defaultLLMTimeout    = 10 * time.Minute
+	providerOpenAI       = "openai"
+	providerOpenRouter   = "openrouter"
+	providerOpenAICompat = "openai-compatible"
+	providerOllama       = "ollama"
+	providerAnthropic    = "anthropic"
+
+	defaultLLMMaxRetries   = 1
+	defaultLLMRetryBackoff = 2 * time.Second
+	defaultLLMMaxRetryWait = 60 * time.Second
+)
+
+// chatMessage is one message of a chat conversation ("system", "user" or "assistant").
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest is what the writer asks a provider for.
+type chatRequest struct {
+	Messages []chatMessage
+	// Params override the provider's configured generation settings.
+	Params GenerationParams
+	// Source is what made the call ("writer", "chat" or "batch"), recorded with its token usage.
+	Source string
+	// UsageDB is the history DB to record token usage in; nil opens it for the call.
+	UsageDB *sql.DB
+}
+
+// override returns p with every field that is set in o replaced.
+func (p GenerationParams) override(o GenerationParams) GenerationParams {
+	if o.Temperature != nil {
+		p.Temperature = o.Temperature
+	}
+	if o.TopP != nil {
+		p.TopP = o.TopP
+	}
+	if o.MaxTokens != nil {
+		p.MaxTokens = o.MaxTokens
+	}
+	if o.Stop != nil {
+		p.Stop = o.Stop
+	}
+	if o.Seed != nil {
+		p.Seed = o.Seed
+	}
+	if o.ResponseFormat != "" {
+		p.ResponseFormat = o.ResponseFormat
+	}
+	return p
+}
+
+func (p GenerationParams) validate() error {
+	switch p.ResponseFormat {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unknown response_format %q (use text or json)", p.ResponseFormat)
+	}
+	if p.MaxTokens != nil && *p.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be positive")
+	}
+	return nil
+}
+
+// json reports whether JSON mode is requested.
+func (p GenerationParams) json() bool {
+	return p.ResponseFormat == "json"
+}
+
+// String lists the settings that are set, e.g. "temperature=0.7 max_tokens=800", for verbose output.
+func (p GenerationParams) String() string {
+	var parts []string
+	if p.Temperature != nil {
+		parts = append(parts, fmt.Sprintf("temperature=%g", *p.Temperature))
+	}
+	if p.TopP != nil {
+		parts = append(parts, fmt.Sprintf("top_p=%g", *p.TopP))
+	}
+	if p.MaxTokens != nil {
+		parts = append(parts, fmt.Sprintf("max_tokens=%d", *p.MaxTokens))
+	}
+	if len(p.Stop) > 0 {
+		parts = append(parts, fmt.Sprintf("stop=%q", p.Stop))
+	}
+	if p.Seed != nil {
+		parts = append(parts, fmt.Sprintf("seed=%d", *p.Seed))
+	}
+	if p.ResponseFormat != "" {
+		parts = append(parts, "response_format="+p.ResponseFormat)
+	}
+	if len(parts) == 0 {
+		return "API defaults"
+	}
+	return strings.Join(parts, " ")
+}
+
+// chatUsage is the token usage reported by a provider, if any.
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// chatResult is the full reply once the stream has ended.
+type chatResult struct {
+	Content string
+	Usage   *chatUsage
+}
+
+// chatProvider streams a chat completion from one LLM API; onDelta receives each piece of text
+// as it arrives.
+type chatProvider interface {
+	Name() string
+	Model() string
+	// Params are the provider's configured generation settings; requests may override them.
+	Params() GenerationParams
+	StreamChat(req chatRequest, onDelta func(string)) (*chatResult, error)
+}
+
+// llmHTTPError is a non-200 response from an LLM API.
+type llmHTTPError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+	// RetryAfter is the Retry-After header in seconds, if any.
+	RetryAfter int
+}
+
+func (e *llmHTTPError) Error() string {
+	return fmt.Sprintf("%s API error: %d %s", e.Provider, e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// newProvider builds the provider called name from its config section. The type defaults to the
+// name for the built-in kinds, so [providers.ollama] needs no type line.
+func newProvider(name string, cfg ProviderConfig) (chatProvider, error) {
+	kind := cfg.Type
+	if kind == "" {
+		kind = name
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("provider %q has no model", name)
+	}
+	if err := cfg.GenerationParams.validate(); err != nil {
+		return nil, fmt.Errorf("provider %q: %w", name, err)
+	}
+	params := cfg.GenerationParams
+	timeout := defaultLLMTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	httpClient := &http.Client{Timeout: timeout}
+	base := strings.TrimRight(cfg.BaseURL, "/")
+	switch kind {
+	case providerOpenAI, providerOpenRouter, providerOpenAICompat:
+		url := base + "/chat/completions"
+		switch {
+		case base == "" && kind == providerOpenAI:
+			url = openAIURL
+		case base == "" && kind == providerOpenRouter:
+			url = openRouterURL
+		case base == "":
+			return nil, fmt.Errorf("provider %q (openai-compatible) needs base_url, e.g. http://localhost:8080/v1", name)
+		}
+		if cfg.APIKey == "" && kind != providerOpenAICompat {
+			return nil, fmt.Errorf("provider %q has no api_key", name)
+		}
+		return &openAIProvider{name: name, kind: kind, url: url, apiKey: cfg.APIKey, model: cfg.Model, params: params, client: httpClient}, nil
+	case providerOllama:
+		if base == "" {
+			base = defaultOllamaURL
+		}
+		return &ollamaProvider{name: name, url: base + "/api/chat", apiKey: cfg.APIKey, model: cfg.Model, params: params, client: httpClient}, nil
+	case providerAnthropic:
+		if base == "" {
+			base = defaultAnthropicURL
+		}
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("provider %q has no api_key", name)
+		}
+		return &anthropicProvider{name: name, url: base + "/v1/messages", apiKey: cfg.APIKey, model: cfg.Model, params: params, client: httpClient}, nil
+	}
+	return nil, fmt.Errorf("provider %q has unknown type %q (use openai, openrouter, openai-compatible, ollama or anthropic)", name, kind)
+}
+
+// writerProviders returns the writer's provider chain: [writer] providers, or [writer] provider, or
+// without either the legacy [openai] and [openrouter] sections, OpenAI first.
+func writerProviders(config *Config) ([]chatProvider, error) {
+	entries := config.Writer.Providers
+	switch {
+	case len(entries) > 0 && config.Writer.Provider != "":
+		return nil, fmt.Errorf("set either provider or providers in [writer], not both")
+	case config.Writer.Provider != "":
+		entries = []string{config.Writer.Provider}
+	case len(entries) == 0:
+		if config.OpenAI.APIKey != "" && config.OpenAI.Model != "" {
+			entries = append(entries, providerOpenAI)
+		}
+		if config.OpenRouter.APIKey != "" && config.OpenRouter.Model != "" {
+			entries = append(entries, providerOpenRouter)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("for -W/--writer, set [writer] provider with a [providers.NAME] section, or [openai] or [openrouter] api_key and model in config")
+	}
+	var chain []chatProvider
+	for _, entry := range entries {
+		p, err := providerEntry(config, entry)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+// providerEntry builds the provider for a chain entry, "NAME" or "NAME:MODEL".
+func providerEntry(config *Config, entry string) (chatProvider, error) {
+	name, model, _ := strings.Cut(entry, ":")
+	return namedProvider(config, strings.TrimSpace(name), strings.TrimSpace(model))
+}
+
+// namedProvider looks name up in [providers], falling back to the [openai] and [openrouter] sections.
+// A non-empty model replaces the configured one.
+func namedProvider(config *Config, name, model string) (chatProvider, error) {
+	cfg, ok := config.Providers[name]
+	if !ok {
+		switch name {
+		case providerOpenAI:
+			cfg = ProviderConfig{APIKey: config.OpenAI.APIKey, Model: config.OpenAI.Model}
+		case providerOpenRouter:
+			cfg = ProviderConfig{APIKey: config.OpenRouter.APIKey, Model: config.OpenRouter.Model}
+		default:
+			return nil, fmt.Errorf("unknown provider %q (add a [providers.%s] section to the config file)", name, name)
+		}
+	}
+	if model != "" {
+		cfg.Model = model
+	}
+	return newProvider(name, cfg)
+}
+
+// retryPolicy says how often each provider in a chain is retried and how long to wait in between.
+type retryPolicy struct {
+	MaxRetries   int
+	RetryBackoff time.Duration
+	MaxRetryWait time.Duration
+}
+
+// writerRetryPolicy reads the retry settings from [writer], filling in defaults.
+func writerRetryPolicy(cfg WriterConfig) retryPolicy {
+	p := retryPolicy{
+		MaxRetries:   defaultLLMMaxRetries,
+		RetryBackoff: time.Duration(cfg.RetryBackoff * float64(time.Second)),
+		MaxRetryWait: time.Duration(cfg.MaxRetryWait) * time.Second,
+	}
+	if cfg.MaxRetries != nil && *cfg.MaxRetries >= 0 {
+		p.MaxRetries = *cfg.MaxRetries
+	}
+	if p.RetryBackoff <= 0 {
+		p.RetryBackoff = defaultLLMRetryBackoff
+	}
+	if p.MaxRetryWait <= 0 {
+		p.MaxRetryWait = defaultLLMMaxRetryWait
+	}
+	return p
+}
+
+// errEmptyContent is returned for a stream that ended without any text.
+var errEmptyContent = errors.New("API returned empty content")
+
+// retryableLLMError reports whether another attempt, or the next provider, may succeed:
+// rate limiting (429), server errors (5xx), timeouts and other network failures, or empty content.
+func retryableLLMError(err error) bool {
+	var httpErr *llmHTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, errEmptyContent)
+}
+
+// providerLabel names a provider and its model in messages, e.g. "openrouter (gemma-2-9b-it:free)".
+func providerLabel(p chatProvider) string {
+	return fmt.Sprintf("%s (%s)", p.Name(), p.Model())
+}
+
+// sentParams returns the generation settings p sends for a request with params: its own, overridden
+// by params, without those its API does not take. Verbose output lists these.
+func sentParams(p chatProvider, params GenerationParams) GenerationParams {
+	params = p.Params().override(params)
+	if _, ok := p.(*anthropicProvider); ok {
+		params.Seed = nil // the Messages API has no seed
+	}
+	return params
+}
+
+// streamChatChain tries each provider in chain in order, retrying retryable errors per policy
+// before moving on to the next, and returns the provider that produced the result. onAttempt is
+// called before every attempt, with retry set after the first, so the caller can set aside partial
+// output.
+// Each retry and fallback is logged to stderr.
+func streamChatChain(chain []chatProvider, policy retryPolicy, req chatRequest, onDelta func(string), onAttempt func(p chatProvider, retry bool)) (chatProvider, *chatResult, error) {
+	var failures []string
+	var lastErr error
+	for i, p := range chain {
+		for attempt := 0; ; attempt++ {
+			onAttempt(p, i > 0 || attempt > 0)
+			res, err := p.StreamChat(req, onDelta)
+			if err == nil && strings.TrimSpace(res.Content) == "" {
+				err = errEmptyContent
+			}
+			if err == nil {
+				recordUsage(req.UsageDB, p, res.Usage, req.Source)
+				return p, res, nil
+			}
+			if !retryableLLMError(err) {
+				return p, nil, err
+			}
+			wait := policy.RetryBackoff << uint(attempt)
+			var httpErr *llmHTTPError
+			if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+				wait = time.Duration(httpErr.RetryAfter) * time.Second
+			}
+			if attempt >= policy.MaxRetries || wait > policy.MaxRetryWait {
+				failures = append(failures, fmt.Sprintf("%s: %v", providerLabel(p), err))
+				lastErr = err
+				if i+1 < len(chain) {
+					fmt.Fprintf(os.Stderr, "[writer] %s: %v; falling back to %s\n", providerLabel(p), err, providerLabel(chain[i+1]))
+				}
+				break
+			}
+			fmt.Fprintf(os.Stderr, "[writer] %s: %v; retrying in %s (retry %d/%d)\n", providerLabel(p), err, wait, attempt+1, policy.MaxRetries)
+			time.Sleep(wait)
+		}
+	}
+	if len(chain) == 1 {
+		return chain[0], nil, lastErr
+	}
+	return nil, nil, fmt.Errorf("all %d providers failed: %s", len(failures), strings.Join(failures, "; "))
+}
+
+// postJSON sends body to url and returns the response, or an llmHTTPError for non-200 statuses.
+func postJSON(client *http.Client, provider, url string, headers map[string]string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", provider, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, &llmHTTPError{Provider: provider, StatusCode: resp.StatusCode, Body: string(b), RetryAfter: retryAfter}
+	}
+	return resp, nil
+}
+
+// scanSSE calls onData with the payload of each "data:" line of a server-sent event stream.
+func scanSSE(r io.Reader, onData func(payload string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" || payload == "[DONE]" {
+			continue
+		}
+		onData(payload)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
+
+// openAIProvider speaks the OpenAI chat completions API, which OpenRouter, llama.cpp server,
+// vLLM and LM Studio also implement.
+type openAIProvider struct {
+	name, kind, url, apiKey, model string
+	params                         GenerationParams
+	client                         *http.Client
+}
+
+type openAIRequest struct {
+	Model         string         `json:"model"`
+	Messages      []chatMessage  `json:"messages"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+	Temperature   *float64       `json:"temperature,omitempty"`
+	TopP          *float64       `json:"top_p,omitempty"`
+	MaxTokens     *int           `json:"max_tokens,omitempty"`
+	// MaxCompletionTokens replaces max_tokens on OpenAI itself, where newer models reject the latter.
+	MaxCompletionTokens *int            `json:"max_completion_tokens,omitempty"`
+	Stop                []string        `json:"stop,omitempty"`
+	Seed                *int64          `json:"seed,omitempty"`
+	ResponseFormat      *responseFormat `json:"response_format,omitempty"`
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+// streamOptions asks for a final chunk carrying token usage (stream_options.include_usage).
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIChunk struct {
+	Choices []struct {
+		Delta *struct {
+			Content string `json:"content"`
+		} `json:"delta,omitempty"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage,omitempty"`
+}
+
+func (p *openAIProvider) Name() string             { return p.name }
+func (p *openAIProvider) Model() string            { return p.model }
+func (p *openAIProvider) Params() GenerationParams { return p.params }
+
+func (p *openAIProvider) StreamChat(req chatRequest, onDelta func(string)) (*chatResult, error) {
+	params := p.params.override(req.Params)
+	body := openAIRequest{Model: p.model, Messages: req.Messages, Stream: true,
+		Temperature: params.Temperature, TopP: params.TopP, Stop: params.Stop, Seed: params.Seed}
+	if p.kind == providerOpenAI {
+		body.MaxCompletionTokens = params.MaxTokens
+	} else {
+		body.MaxTokens = params.MaxTokens
+	}
+	if params.json() {
+		body.ResponseFormat = &responseFormat{Type: "json_object"}
+	}
+	// Always ask for usage: it is recorded for every call (see recordUsage).
+	body.StreamOptions = &streamOptions{IncludeUsage: true}
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+	resp, err := postJSON(p.client, p.name, p.url, headers, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res chatResult
+	var content strings.Builder
+	err = scanSSE(resp.Body, func(payload string) {
+		var chunk openAIChunk
+		if json.Unmarshal([]byte(payload), &chunk) != nil {
+			return
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta != nil && chunk.Choices[0].Delta.Content != "" {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+		if chunk.Usage != nil {
+			res.Usage = chunk.Usage
+		}
+	})
+	res.Content = content.String()
+	return &res, err
+}
+
+// ollamaProvider speaks Ollama's native /api/chat, which streams one JSON object per line.
+type ollamaProvider struct {
+	name, url, apiKey, model string
+	params                   GenerationParams
+	client                   *http.Client
+}
+
+type ollamaChunk struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	Error           string `json:"error,omitempty"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+func (p *ollamaProvider) Name() string             { return p.name }
+func (p *ollamaProvider) Model() string            { return p.model }
+func (p *ollamaProvider) Params() GenerationParams { return p.params }
+
+func (p *ollamaProvider) StreamChat(req chatRequest, onDelta func(string)) (*chatResult, error) {
+	params := p.params.override(req.Params)
+	body := map[string]interface{}{"model": p.model, "messages": req.Messages, "stream": true}
+	// Ollama takes sampling settings under options, with its own names for some of them.
+	options := map[string]interface{}{}
+	if params.Temperature != nil {
+		options["temperature"] = *params.Temperature
+	}
+	if params.TopP != nil {
+		options["top_p"] = *params.TopP
+	}
+	if params.MaxTokens != nil {
+		options["num_predict"] = *params.MaxTokens
+	}
+	if len(params.Stop) > 0 {
+		options["stop"] = params.Stop
+	}
+	if params.Seed != nil {
+		options["seed"] = *params.Seed
+	}
+	if len(options) > 0 {
+		body["options"] = options
+	}
+	if params.json() {
+		body["format"] = "json"
+	}
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey // e.g. behind an authenticating proxy
+	}
+	resp, err := postJSON(p.client, p.name, p.url, headers, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res chatResult
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var chunk ollamaChunk
+		if json.Unmarshal(scanner.Bytes(), &chunk) != nil {
+			continue
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("%s error: %s", p.name, chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		if chunk.Done {
+			res.Usage = &chatUsage{PromptTokens: chunk.PromptEvalCount, CompletionTokens: chunk.EvalCount,
+				TotalTokens: chunk.PromptEvalCount + chunk.EvalCount}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	res.Content = content.String()
+	return &res, nil
+}
+
+// anthropicProvider speaks the Anthropic Messages API. System messages are sent in the top-level
+// system field, as the API requires.
+type anthropicProvider struct {
+	name, url, apiKey, model string
+	params                   GenerationParams
+	client                   *http.Client
+}
+
+type anthropicEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Message struct {
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (p *anthropicProvider) Name() string             { return p.name }
+func (p *anthropicProvider) Model() string            { return p.model }
+func (p *anthropicProvider) Params() GenerationParams { return p.params }
+
+// StreamChat sends req to the Messages API. It has no seed, and no JSON mode: that is asked for in
+// the system message instead.
+func (p *anthropicProvider) StreamChat(req chatRequest, onDelta func(string)) (*chatResult, error) {
+	params := p.params.override(req.Params)
+	var system []string
+	var messages []chatMessage
+	for _, m := range req.Messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		messages = append(messages, m)
+	}
+	if params.json() {
+		system = append(system, "Respond with a single valid JSON object and nothing else.")
+	}
+	maxTokens := defaultAnthropicMax
+	if params.MaxTokens != nil {
+		maxTokens = *params.MaxTokens
+	}
+	body := map[string]interface{}{
+		"model":      p.model,
+		"messages":   messages,
+		"max_tokens": maxTokens,
+		"stream":     true,
+	}
+	if params.Temperature != nil {
+		body["temperature"] = *params.Temperature
+	}
+	if params.TopP != nil {
+		body["top_p"] = *params.TopP
+	}
+	if len(params.Stop) > 0 {
+		body["stop_sequences"] = params.Stop
+	}
+	if len(system) > 0 {
+		body["system"] = strings.Join(system, "\n\n")
+	}
+	headers := map[string]string{"x-api-key": p.apiKey, "anthropic-version": anthropicVersion}
+	resp, err := postJSON(p.client, p.name, p.url, headers, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res chatResult
+	var content strings.Builder
+	var usage chatUsage
+	var streamErr error
+	err = scanSSE(resp.Body, func(payload string) {
+		var ev anthropicEvent
+		if json.Unmarshal([]byte(payload), &ev) != nil {
+			return
+		}
+		switch ev.Type {
+		case "message_start":
+			usage.PromptTokens = ev.Message.Usage.InputTokens
+		case "content_block_delta":
+			if ev.Delta.Type == "text_delta" && ev.Delta.Text != "" {
+				content.WriteString(ev.Delta.Text)
+				onDelta(ev.Delta.Text)
+			}
+		case "message_delta":
+			usage.CompletionTokens = ev.Usage.OutputTokens
+		case "error":
+			if ev.Error != nil {
+				streamErr = fmt.Errorf("%s error: %s", p.name, ev.Error.Message)
+			}
+		}
+	})
+	if err == nil {
+		err = streamErr
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	res.Content, res.Usage = content.String(), &usage
+	return &res, err
+}
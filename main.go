@@ -17,21 +17,61 @@ Version: %s
 
 Usage:
   cairn [flags]
+  cairn <command> [flags]
+
+Commands:
+  history             List posts recorded in ~/.cairn_history.db
+                      (-s TEXT, -t TAG, --flow NAME, --since DATE, --until DATE, -n LIMIT, --full)
+  queue               List scheduled posts (-a for all); queue cancel ID; queue reschedule ID TIME
+  daemon              Send scheduled posts when due, retrying failures
+                      (--interval 30s, --max-attempts 5, --once)
+  delete ID...        Delete messages (--group: the whole album each ID belongs to)
+  pin ID              Pin a message (--silent: no notification)
+  unpin [ID...]       Unpin messages, the latest pin, or everything with --all
+                      (delete/pin/unpin take -c PATH and --channel NAME)
+  chat                Talk to the writer's LLM interactively (/save, /post, /model, /reset);
+                      -p PROMPT to start from a prompt file, --resume [ID], --list
+  batch DIR|GLOB...   Run many prompt files, --jobs N at a time (default 4), writing NAME.out.md
+                      next to each prompt or NAME.md into --out-dir DIR; --resume skips finished ones
+  usage               LLM token usage and cost ([prices]) by day and model
+                      (--since DATE, --until DATE, --model NAME)
 
 Flags:
   -h, --help          Show this help message
   -c, --config PATH   Path to config file (default: ~/.cairn.toml)
   -p, --post TEXT     Content to post (can include tags with #)
   -f, --file PATH     Read content from a file
-  -P, --photo PATH   Path to photo file(s) to post (comma or space-separated, caption from -p or -f)
+  -P, --photo PATH   Path to photo or other media file(s) to post (comma or space-separated, caption from -p or -f);
+                     video, GIF, audio, voice (.ogg) and documents are detected by extension or content
+      --as TYPE       Send -P files as photo, video, animation, audio, voice or document instead of detecting
+      --album-caption MODE  More than 10 files are sent as several albums; caption on the first album only
+                      (first, default), on every album (repeat), or on every album numbered 1/3, 2/3... (number)
   -m, --morning       Get Fitbit sleep data and post to Telegram channel
-  -W, --writer PATH   Read setting from file, send to OpenAI or OpenRouter (streaming), get generated content
-  -o, --output PATH   Write generated content to file (use with -W)
+  -W, --writer PATH   Read setting from file, send to the configured LLM provider, stream the result to stdout
+  -o, --output PATH   Write generated content to file (use with -W; the stream then goes to stderr)
+      --usage         With -W: print prompt/completion token usage (and cost) when the stream ends
+      --publish       With -W: show the generated content and post it to the channel (flow "writer")
+      --review        With -W --publish: open the content in $EDITOR first; an emptied file aborts
+  -v, --verbose       With -W: print the provider, model and effective generation settings of each request
+      --var NAME=VALUE  With -W: fill {{NAME}} in the prompt file (repeatable; also {{date}}, {{file:PATH}}, env)
   -d, --dict WORD     Look up word meaning (Free Dictionary API)
   -F, --places-file PATH  Geocode places from file, one per line ([google] api_key); use - for stdin
   -T, --travel        With -F: optimize visit order (great-circle km); first line = start
       --travel-open   With -T: mode 2 — end at last stop; do not return to the first place (default: mode 1, round trip)
-  -u, --update ID     Update message/caption by ID (-p/-f), or replace photo (-P with one file)
+  -u, --update ID     Update message/caption by ID (-p/-f), or replace media (-P with one file)
+      --format FORMAT Input format of -p/-f text: html (default), markdown or plain
+      --button-row ROW  Add a row of URL buttons written as Markdown links: "[Open map](https://...) [Docs](https://...)";
+                      repeat for more rows. With -u and no -p/-f/-P, only the buttons are changed
+      --clear-buttons With -u: remove the message's buttons (edits keep them otherwise)
+      --silent        Send without notification (e.g. early --morning posts)
+      --protect       Protect the post from forwarding and saving
+      --no-preview    Disable link previews (also for -u text edits)
+                      (defaults per flow: silent, protect, no_preview under [flows.NAME])
+      --reply-to ID   Reply to message ID, or to today's latest post of a flow: --reply-to morning
+                      (flows: post, photo, morning)
+      --channel NAME  Post to a [telegram.channels.NAME] profile instead of the default channel;
+                      repeat or comma-separate (--channel team,test) to broadcast a -p/-f/-P post
+      --at TIME       Schedule the -p/-f/-P post instead of sending now ("YYYY-MM-DD HH:MM" or "HH:MM"); run "cairn daemon" to send
 
 Examples:
   cairn -p "Hello world #tag1 #tag2"
@@ -40,10 +80,17 @@ Examples:
   cairn -P image1.jpg,image2.jpg -p "Multiple photos"
   cairn -P image1.jpg image2.jpg -p "Multiple photos"
   cairn --photo image.jpg -f caption.txt
+  cairn -P report.pdf -p "Monthly report"
+  cairn -P clip.mp4 a.jpg -p "Photos and a clip"
+  cairn -P trip/*.jpg -p "Day 3" --album-caption number
+  cairn -P note.ogg
+  cairn -P big.jpg --as document -p "Uncompressed original"
   cairn -c ~/.custom_cairn.toml -p "Custom config"
   cairn --morning
   cairn -W prompt.txt
   cairn -W prompt.txt -o result.txt
+  cairn -W prompt.txt --publish --review --format markdown
+  cairn -W weekly.md --var topic="Trail running" -o post.md
   cairn -d hello
   cairn --dict word
   cairn -F places.txt
@@ -53,22 +100,88 @@ Examples:
   cairn -u 123 -p "Corrected message"
   cairn -u 456 -p "New caption"           # update photo caption
   cairn -u 456 -P new.jpg -p "New caption" # replace photo and caption
+  cairn -u 456 -P clip.mp4                 # replace with a video
+  cairn -f notes.md --format markdown
+  cairn -f tomorrow.txt --at "2026-10-17 08:00"
+  cairn -p "Evening notes" --reply-to morning
+  cairn -p "Read this: https://example.com" --no-preview --silent
+  cairn -P dinner.jpg lunch.jpg -p "Food" --reply-to 123
+  cairn -p "Release notes" --channel team
+  cairn -p "Route for Saturday" --button-row "[Open map](https://maps.google.com/?q=Lisbon)"
+  cairn -u 123 --button-row "[Full entry](https://example.com/entry) [Source](https://example.com/src)"
+  cairn -P demo.mp4 -p "New build" --channel team --channel test
+  cairn queue
+  cairn queue reschedule 3 "2026-10-17 09:30"
+  cairn daemon
+  cairn history -t sleep --since 2026-10-01
+  cairn delete 123 124
+  cairn delete --group 130
+  cairn pin --silent 123
+  cairn unpin --all
+  cairn history -s "Lisbon" --full
 `, version)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		var run func(args []string) error
+		switch os.Args[1] {
+		case "history":
+			run = History
+		case "queue":
+			run = Queue
+		case "daemon":
+			run = Daemon
+		case "delete":
+			run = Delete
+		case "pin":
+			run = Pin
+		case "unpin":
+			run = Unpin
+		case "chat":
+			run = Chat
+		case "batch":
+			run = Batch
+		case "usage":
+			run = Usage
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	configPath := pflag.StringP("config", "c", "~/.cairn.toml", "Path to config file")
 	postContent := pflag.StringP("post", "p", "", "Content to post")
 	filePath := pflag.StringP("file", "f", "", "Read content from a file")
-	photoPathStr := pflag.StringP("photo", "P", "", "Path to photo file(s) to post (comma-separated)")
+	photoPathStr := pflag.StringP("photo", "P", "", "Path to photo or media file(s) to post (comma-separated)")
+	mediaAs := pflag.String("as", "", "Send -P files as this media type instead of detecting it")
+	albumCaption := pflag.String("album-caption", albumCaptionFirst, "Caption placement when files span several albums: first, repeat or number")
 	morning := pflag.BoolP("morning", "m", false, "Get Fitbit sleep data and post to Telegram channel")
-	writerPath := pflag.StringP("writer", "W", "", "Read setting from file, send to OpenRouter (streaming), get generated content")
+	writerPath := pflag.StringP("writer", "W", "", "Read setting from file, send to the configured LLM provider (streaming), get generated content")
 	outputPath := pflag.StringP("output", "o", "", "Write generated content to file (use with -W)")
+	publish := pflag.Bool("publish", false, "With -W: post the generated content to the channel")
+	showUsage := pflag.Bool("usage", false, "With -W: print token usage after the result")
+	review := pflag.Bool("review", false, "With -W --publish: edit the content in $EDITOR before posting")
+	verbose := pflag.BoolP("verbose", "v", false, "With -W: print the provider, model and generation settings of each request")
+	varFlags := pflag.StringArray("var", nil, "With -W: set a prompt template variable, NAME=VALUE (repeatable)")
 	dictWord := pflag.StringP("dict", "d", "", "Look up word meaning")
 	placesFile := pflag.StringP("places-file", "F", "", "Read place names to geocode, one per line (- for stdin)")
 	travel := pflag.BoolP("travel", "T", false, "With -F: optimize route (great-circle); first line is start; add --travel-open for no return")
 	travelOpen := pflag.Bool("travel-open", false, "With -T: open path — do not return to first place")
 	updateMsgID := pflag.StringP("update", "u", "", "Message ID to update (use with -p or -f for new content)")
+	at := pflag.String("at", "", "Schedule the post for this time instead of sending now")
+	format := pflag.String("format", "", "Input format of -p/-f text: html, markdown or plain")
+	buttonRows := pflag.StringArray("button-row", nil, "Row of URL buttons as Markdown links, e.g. \"[Open map](https://...)\"; repeat for more rows")
+	clearButtons := pflag.Bool("clear-buttons", false, "With -u: remove the message's buttons")
+	pflag.Bool("silent", false, "Send without notification")
+	pflag.Bool("protect", false, "Protect the post from forwarding and saving")
+	pflag.Bool("no-preview", false, "Disable link previews")
+	replyTo := pflag.String("reply-to", "", "Reply to this message ID, or to today's latest post of a flow (e.g. morning)")
+	channelNames := pflag.StringSlice("channel", nil, "Post to this [telegram.channels] profile; repeat or comma-separate to broadcast")
 	help := pflag.BoolP("help", "h", false, "Show help message")
 
 	pflag.Parse()
@@ -85,31 +198,118 @@ func main() {
 		os.Exit(1)
 	}
 
+	// A -f file may start with front-matter; its options apply where no flag overrides them.
+	var fileBody string
+	var fm frontMatter
+	if *filePath != "" {
+		if fileBody, fm, err = readPostFile(*filePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *format == "" {
+			*format = fm.Format
+		}
+		if len(*channelNames) == 0 {
+			*channelNames = fm.channels()
+		}
+		if len(*buttonRows) == 0 {
+			*buttonRows = fm.Buttons
+		}
+	}
+
+	inputFormat := config.Telegram.Format
+	if *format != "" {
+		inputFormat = *format
+	}
+	if _, err := formatContent("", inputFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !validAlbumCaption(*albumCaption) {
+		fmt.Fprintf(os.Stderr, "Error: unknown --album-caption %q (use first, repeat or number)\n", *albumCaption)
+		os.Exit(1)
+	}
+
+	buttons, err := parseButtonRows(*buttonRows)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *clearButtons && (*updateMsgID == "" || len(buttons) > 0) {
+		fmt.Fprintln(os.Stderr, "Error: --clear-buttons is used with -u and without --button-row")
+		os.Exit(1)
+	}
+
+	if *at != "" && (*morning || *writerPath != "" || *updateMsgID != "") {
+		fmt.Fprintln(os.Stderr, "Error: --at can only schedule -p/-f/-P posts")
+		os.Exit(1)
+	}
+	if *replyTo != "" && *updateMsgID != "" {
+		fmt.Fprintln(os.Stderr, "Error: --reply-to cannot be used with -u (Telegram cannot change what a message replies to)")
+		os.Exit(1)
+	}
+	if *replyTo == "" && fm.ReplyTo != 0 {
+		*replyTo = strconv.FormatInt(fm.ReplyTo, 10)
+	}
+	replyToID, replyToFlow, err := parseReplyTo(*replyTo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var channel string
+	if names := uniqueStrings(*channelNames); len(names) > 1 && (*morning || *updateMsgID != "" || *writerPath != "") {
+		fmt.Fprintln(os.Stderr, "Error: several --channel values can only be used to broadcast -p/-f/-P posts")
+		os.Exit(1)
+	} else if len(names) == 1 {
+		channel = names[0]
+	}
+
 	if *morning {
-		if err := requireTelegram(config); err != nil {
+		channelFormat, err := inputFormatFor(config, channel, *format)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 		var additionalText string
 		content, file := *postContent, *filePath
 		if file != "" {
-			additionalText, err = readFileContent(file)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
-			}
+			additionalText = fileBody
 		} else if content != "" {
 			additionalText = content
 		}
-		if err := Morning(config, additionalText); err != nil {
+		if additionalText, err = formatContent(additionalText, channelFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		post := outgoingPost{ReplyTo: replyToID, ReplyToFlow: replyToFlow, Channel: channel, Flow: "morning"}
+		setSendOptions(config, &post, fm)
+		if err := Morning(config, additionalText, post); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 		return
 	}
 
+	if *review && !*publish {
+		fmt.Fprintln(os.Stderr, "Error: --review is used with -W --publish")
+		os.Exit(1)
+	}
 	if *writerPath != "" {
-		if err := Writer(config, *writerPath, *outputPath); err != nil {
+		opts := writerOptions{OutputPath: *outputPath, Review: *review, Usage: *showUsage, Verbose: *verbose}
+		if opts.Vars, err = parseVars(*varFlags); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *publish {
+			if opts.Format, err = inputFormatFor(config, channel, *format); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			opts.Post = &outgoingPost{Buttons: buttons, ReplyTo: replyToID, ReplyToFlow: replyToFlow, Channel: channel, Flow: "writer"}
+			setSendOptions(config, opts.Post, fm)
+		}
+		if err := Writer(config, *writerPath, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -166,7 +366,8 @@ func main() {
 	}
 
 	if *updateMsgID != "" {
-		if err := requireTelegram(config); err != nil {
+		channelFormat, err := inputFormatFor(config, channel, *format)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -194,22 +395,32 @@ func main() {
 		if len(updatePhotos) == 1 {
 			var newCaption string
 			if file != "" {
-				newCaption, err = readFileContent(file)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-					os.Exit(1)
-				}
+				newCaption = fileBody
 			} else {
 				newCaption = content
 			}
-			if err := editMessageMediaTelegram(config.Telegram.BotToken, config.Telegram.ChannelID, msgID, updatePhotos[0], newCaption); err != nil {
+			if newCaption, err = formatContent(newCaption, channelFormat); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			post := &outgoingPost{Text: newCaption, Photos: updatePhotos, MediaType: *mediaAs, Buttons: buttons, ClearButtons: *clearButtons,
+				Tags: fm.Tags, Channel: channel, Flow: "update"}
+			setSendOptions(config, post, fm)
+			if err := editPost(config, msgID, post); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		if content == "" && file == "" && len(updatePhotos) == 0 && (len(buttons) > 0 || *clearButtons) {
+			if err := editButtons(config, channel, msgID, buttons); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
 			return
 		}
 		if content == "" && file == "" {
-			fmt.Fprintln(os.Stderr, "Error: -u/--update requires -p or -f for the new content (or -P with one photo to replace the image)")
+			fmt.Fprintln(os.Stderr, "Error: -u/--update requires -p or -f for the new content (or -P with one file to replace the media, or --button-row/--clear-buttons)")
 			os.Exit(1)
 		}
 		if content != "" && file != "" {
@@ -218,19 +429,17 @@ func main() {
 		}
 		var newContent string
 		if file != "" {
-			newContent, err = readFileContent(file)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
-			}
+			newContent = fileBody
 		} else {
 			newContent = content
 		}
-		err = editMessageTelegram(config.Telegram.BotToken, config.Telegram.ChannelID, msgID, newContent)
-		if err != nil && (strings.Contains(err.Error(), "message has no text") || strings.Contains(err.Error(), "no text in the message to edit")) {
-			err = editMessageCaptionTelegram(config.Telegram.BotToken, config.Telegram.ChannelID, msgID, newContent)
+		if newContent, err = formatContent(newContent, channelFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
-		if err != nil {
+		post := &outgoingPost{Text: newContent, Buttons: buttons, ClearButtons: *clearButtons, Tags: fm.Tags, Channel: channel, Flow: "update"}
+		setSendOptions(config, post, fm)
+		if err := editPost(config, msgID, post); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -254,10 +463,16 @@ func main() {
 			}
 		}
 	}
+	if len(photos) == 0 {
+		photos = fm.Photos
+	}
+	if *at == "" {
+		*at = fm.At
+	}
 
 	if len(photos) == 0 {
 		if content == "" && file == "" {
-			fmt.Fprintln(os.Stderr, "Error: Either --post or --file must be provided (or use -P/--photo to post a photo, -m/--morning for sleep data, -W/--writer for OpenRouter, -F/--places-file to geocode or -T with -F for a round trip, or -d/--dict)")
+			fmt.Fprintln(os.Stderr, "Error: Either --post or --file must be provided (or use -P/--photo to post a photo, -m/--morning for sleep data, -W/--writer for an LLM, -F/--places-file to geocode or -T with -F for a round trip, or -d/--dict)")
 			printHelp()
 			os.Exit(1)
 		}
@@ -269,36 +484,132 @@ func main() {
 
 	var finalContent string
 	if file != "" {
-		finalContent, err = readFileContent(file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		finalContent = fileBody
 	} else {
 		finalContent = content
 	}
 
-	if err := requireTelegram(config); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	targets := uniqueStrings(*channelNames)
+	if len(targets) == 0 {
+		targets = []string{""}
 	}
-
-	if len(photos) > 0 {
-		if len(photos) == 1 {
-			if _, err := postPhotoToTelegram(config.Telegram.BotToken, config.Telegram.ChannelID, photos[0], finalContent); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
-			}
-		} else {
-			if _, err := postMultiplePhotosToTelegram(config.Telegram.BotToken, config.Telegram.ChannelID, photos, finalContent); err != nil {
+	var posts []*outgoingPost
+	for _, name := range targets {
+		channelFormat, err := inputFormatFor(config, name, *format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		text, err := formatContent(finalContent, channelFormat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		post := &outgoingPost{Text: text, Photos: photos, MediaType: *mediaAs, AlbumCaption: *albumCaption, Buttons: buttons,
+			Tags: fm.Tags, ReplyTo: replyToID, ReplyToFlow: replyToFlow, Channel: name, Flow: "post"}
+		if len(photos) > 0 {
+			post.Flow = "photo"
+		}
+		setSendOptions(config, post, fm)
+		posts = append(posts, post)
+	}
+	if *at != "" {
+		due, err := parseScheduleTime(*at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, post := range posts {
+			id, err := enqueuePost(config, *post, due)
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
+			fmt.Fprintf(os.Stderr, "Scheduled post #%d for %s (run \"cairn daemon\" to send it)\n", id, due.Format("2006-01-02 15:04"))
 		}
-	} else {
-		if _, err := postToTelegram(config.Telegram.BotToken, config.Telegram.ChannelID, finalContent); err != nil {
+		return
+	}
+	if len(posts) > 1 {
+		if err := broadcastPosts(config, posts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		return
+	}
+	if _, err := sendPost(config, posts[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// inputFormatFor returns the input format for text posted to channel: --format if given,
+// else the channel profile's format, else the [telegram] format. It also checks that the
+// channel is fully configured.
+func inputFormatFor(config *Config, channel, flagFormat string) (string, error) {
+	tg, err := channelConfig(config, channel)
+	if err != nil {
+		return "", err
+	}
+	if flagFormat != "" {
+		return flagFormat, nil
+	}
+	if _, err := formatContent("", tg.Format); err != nil {
+		return "", fmt.Errorf("channel %q: %w", channel, err)
+	}
+	return tg.Format, nil
+}
+
+// setSendOptions sets p's silent, protect and no-preview options: a --silent, --protect or
+// --no-preview flag given on the command line wins, then the -f front-matter, then the
+// defaults of p's flow in [flows.NAME].
+func setSendOptions(config *Config, p *outgoingPost, fm frontMatter) {
+	flow := config.Flows[p.Flow]
+	resolve := func(name string, fromFile *bool, fromFlow bool) bool {
+		if pflag.Lookup(name).Changed {
+			v, _ := pflag.CommandLine.GetBool(name)
+			return v
+		}
+		if fromFile != nil {
+			return *fromFile
+		}
+		return fromFlow
+	}
+	p.Silent = resolve("silent", fm.Silent, flow.Silent)
+	p.Protect = resolve("protect", fm.Protect, flow.Protect)
+	p.NoPreview = resolve("no-preview", fm.NoPreview, flow.NoPreview)
+}
+
+// parseReplyTo reads --reply-to: a message ID, or the name of a flow whose latest post today
+// is looked up in history when sending (e.g. "morning").
+func parseReplyTo(s string) (int64, string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, "", nil
+	}
+	if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if id <= 0 {
+			return 0, "", fmt.Errorf("--reply-to message ID must be positive")
+		}
+		return id, "", nil
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return 0, "", fmt.Errorf("--reply-to takes a message ID or a flow name such as morning, got %q", s)
+		}
+	}
+	return 0, s, nil
+}
+
+// uniqueStrings returns the non-empty values of list without duplicates, keeping their order.
+func uniqueStrings(list []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
 	}
+	return out
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/pflag"
+)
+
+// managedChannel loads the config and returns a client and chat ID for the --channel profile.
+func managedChannel(configPath, channel string) (*TelegramClient, string, error) {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, "", err
+	}
+	tg, err := channelConfig(config, channel)
+	if err != nil {
+		return nil, "", err
+	}
+	return newTelegramClient(tg), tg.ChannelID, nil
+}
+
+// parseMessageIDs parses positional message ID arguments.
+func parseMessageIDs(args []string) ([]int64, error) {
+	var ids []int64
+	for _, a := range args {
+		id, err := strconv.ParseInt(a, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("message ID must be a positive integer, got %q", a)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Delete runs "cairn delete": delete messages by ID, optionally expanding each to its whole album.
+func Delete(args []string) error {
+	fs := pflag.NewFlagSet("delete", pflag.ContinueOnError)
+	configPath := fs.StringP("config", "c", "~/.cairn.toml", "Path to config file")
+	channel := fs.String("channel", "", "Channel profile the messages are in (default channel if empty)")
+	group := fs.BoolP("group", "g", false, "Delete the whole album (media group) each ID belongs to, looked up in history")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ids, err := parseMessageIDs(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("usage: cairn delete [--group] ID [ID...]")
+	}
+	client, chatID, err := managedChannel(*configPath, *channel)
+	if err != nil {
+		return err
+	}
+	if *group {
+		seen := map[int64]bool{}
+		var expanded []int64
+		for _, id := range ids {
+			album, err := albumMessageIDs(chatID, id)
+			if err != nil {
+				return err
+			}
+			for _, a := range album {
+				if !seen[a] {
+					seen[a] = true
+					expanded = append(expanded, a)
+				}
+			}
+		}
+		ids = expanded
+	}
+	if err := client.deleteMessages(chatID, ids); err != nil {
+		return err
+	}
+	recordPost(postRecord{ChatID: chatID, MessageIDs: ids, Action: "delete"})
+	return nil
+}
+
+// Pin runs "cairn pin": pin a message, optionally without notifying subscribers.
+func Pin(args []string) error {
+	fs := pflag.NewFlagSet("pin", pflag.ContinueOnError)
+	configPath := fs.StringP("config", "c", "~/.cairn.toml", "Path to config file")
+	channel := fs.String("channel", "", "Channel profile the message is in (default channel if empty)")
+	silent := fs.BoolP("silent", "s", false, "Pin without notifying subscribers")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ids, err := parseMessageIDs(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return fmt.Errorf("usage: cairn pin [--silent] ID")
+	}
+	client, chatID, err := managedChannel(*configPath, *channel)
+	if err != nil {
+		return err
+	}
+	if err := client.pinChatMessage(chatID, ids[0], *silent); err != nil {
+		return err
+	}
+	recordPost(postRecord{ChatID: chatID, MessageIDs: ids, Action: "pin"})
+	return nil
+}
+
+// Unpin runs "cairn unpin": unpin the given messages, the most recent pin, or all pins with --all.
+func Unpin(args []string) error {
+	fs := pflag.NewFlagSet("unpin", pflag.ContinueOnError)
+	configPath := fs.StringP("config", "c", "~/.cairn.toml", "Path to config file")
+	channel := fs.String("channel", "", "Channel profile the messages are in (default channel if empty)")
+	all := fs.BoolP("all", "a", false, "Unpin all pinned messages")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ids, err := parseMessageIDs(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *all && len(ids) > 0 {
+		return fmt.Errorf("use either --all or message IDs, not both")
+	}
+	client, chatID, err := managedChannel(*configPath, *channel)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *all:
+		return client.unpinAllChatMessages(chatID)
+	case len(ids) == 0:
+		return client.unpinChatMessage(chatID, 0)
+	}
+	for _, id := range ids {
+		if err := client.unpinChatMessage(chatID, id); err != nil {
+			return err
+		}
+	}
+	recordPost(postRecord{ChatID: chatID, MessageIDs: ids, Action: "unpin"})
+	return nil
+}
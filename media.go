@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Bot API media types; each is sent with the method "send" + capitalized type (sendPhoto, sendVoice, ...).
+const (
+	mediaPhoto     = "photo"
+	mediaVideo     = "video"
+	mediaAnimation = "animation"
+	mediaAudio     = "audio"
+	mediaVoice     = "voice"
+	mediaDocument  = "document"
+)
+
+var mediaTypeByExt = map[string]string{
+	".jpg": mediaPhoto, ".jpeg": mediaPhoto, ".png": mediaPhoto, ".webp": mediaPhoto,
+	".mp4": mediaVideo, ".m4v": mediaVideo, ".mov": mediaVideo,
+	".gif": mediaAnimation,
+	".mp3": mediaAudio, ".m4a": mediaAudio, ".aac": mediaAudio, ".flac": mediaAudio, ".wav": mediaAudio,
+	".ogg": mediaVoice, ".oga": mediaVoice, ".opus": mediaVoice,
+	".pdf": mediaDocument, ".zip": mediaDocument, ".txt": mediaDocument, ".md": mediaDocument,
+}
+
+var mediaTypeByMIME = map[string]string{
+	"image/jpeg": mediaPhoto, "image/png": mediaPhoto, "image/webp": mediaPhoto,
+	"video/mp4":  mediaVideo,
+	"image/gif":  mediaAnimation,
+	"audio/mpeg": mediaAudio, "audio/wave": mediaAudio, "audio/aiff": mediaAudio,
+	"application/ogg": mediaVoice,
+}
+
+// validMediaType reports whether t is one of the media types above.
+func validMediaType(t string) bool {
+	switch t {
+	case mediaPhoto, mediaVideo, mediaAnimation, mediaAudio, mediaVoice, mediaDocument:
+		return true
+	}
+	return false
+}
+
+// detectMediaType picks the Bot API media type for path from its extension, falling back to sniffing
+// the first bytes of the file. Anything unrecognized is sent as a document.
+func detectMediaType(path string) (string, error) {
+	if t, ok := mediaTypeByExt[strings.ToLower(filepath.Ext(path))]; ok {
+		return t, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	mime := http.DetectContentType(head[:n])
+	if i := strings.IndexByte(mime, ';'); i >= 0 {
+		mime = mime[:i]
+	}
+	if t, ok := mediaTypeByMIME[mime]; ok {
+		return t, nil
+	}
+	return mediaDocument, nil
+}
+
+// mediaTypes returns the media type of each file: override for all of them if set, else detected per file.
+func mediaTypes(paths []string, override string) ([]string, error) {
+	if override != "" && !validMediaType(override) {
+		return nil, fmt.Errorf("unknown media type %q (use photo, video, animation, audio, voice or document)", override)
+	}
+	types := make([]string, len(paths))
+	for i, p := range paths {
+		if override != "" {
+			types[i] = override
+			continue
+		}
+		t, err := detectMediaType(p)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = t
+	}
+	return types, nil
+}
+
+// checkMediaGroup enforces Telegram's album rules: photos and videos may be mixed, but documents
+// and audio files can only be grouped with their own kind, and animations and voice notes cannot be grouped.
+func checkMediaGroup(paths, types []string) error {
+	kinds := map[string]bool{}
+	for i, t := range types {
+		switch t {
+		case mediaAnimation, mediaVoice:
+			return fmt.Errorf("%s (%s) cannot be sent in an album; post it on its own", filepath.Base(paths[i]), t)
+		case mediaPhoto, mediaVideo:
+			kinds["photo/video"] = true
+		default:
+			kinds[t] = true
+		}
+	}
+	if len(kinds) > 1 {
+		return fmt.Errorf("an album can mix photos and videos, but documents and audio must each be grouped only with their own kind")
+	}
+	return nil
+}
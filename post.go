@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// outgoingPost is a text or media post ready to send, either directly or from the schedule queue.
+type outgoingPost struct {
+	Text string `json:"text"`
+	// Photos holds the media files (photos, videos, documents, ...); the name predates other media types.
+	Photos []string `json:"photos,omitempty"`
+	// MediaType forces the media type of every file; empty means detect per file.
+	MediaType string `json:"media_type,omitempty"`
+	// AlbumCaption is how captions are placed when more than 10 files are split into albums.
+	AlbumCaption string `json:"album_caption,omitempty"`
+	// Buttons are inline keyboard rows of URL buttons, attached to the last message of the post.
+	Buttons [][]inlineButton `json:"buttons,omitempty"`
+	// ClearButtons makes an edit without Buttons remove the message's buttons instead of keeping
+	// the ones recorded in history.
+	ClearButtons bool `json:"clear_buttons,omitempty"`
+	// Tags are hashtags for this post on top of the footer's.
+	Tags []string `json:"tags,omitempty"`
+	// Silent sends without notification, Protect forbids forwarding and saving, NoPreview disables
+	// link previews of text messages, and ReplyTo makes the first message a reply to that message ID.
+	Silent    bool  `json:"silent,omitempty"`
+	Protect   bool  `json:"protect,omitempty"`
+	NoPreview bool  `json:"no_preview,omitempty"`
+	ReplyTo   int64 `json:"reply_to,omitempty"`
+	// ReplyToFlow replies to today's most recent post of this flow in the same channel instead,
+	// looked up in history when the post is sent.
+	ReplyToFlow string `json:"reply_to_flow,omitempty"`
+	// PromptPath and Model record where writer posts came from; they are stored in history only.
+	PromptPath string `json:"prompt_path,omitempty"`
+	Model      string `json:"model,omitempty"`
+	// Channel is the [telegram.channels] profile to post to; empty means the default channel.
+	Channel string `json:"channel,omitempty"`
+	Flow    string `json:"flow"`
+}
+
+// Album caption modes for posts with more than 10 files (split into several albums).
+const (
+	albumCaptionFirst  = "first"  // caption on the first album only
+	albumCaptionRepeat = "repeat" // same caption on every album
+	albumCaptionNumber = "number" // caption on every album, followed by "1/3", "2/3", ...
+)
+
+// maxAlbumSize is Telegram's limit on files per media group.
+const maxAlbumSize = 10
+
+// albumSizes splits n files into as few albums as possible, with sizes as even as possible
+// (25 -> 9, 8, 8) so that no album is left with a single file.
+func albumSizes(n int) []int {
+	count := (n + maxAlbumSize - 1) / maxAlbumSize
+	sizes := make([]int, count)
+	for i := range sizes {
+		sizes[i] = n / count
+		if i < n%count {
+			sizes[i]++
+		}
+	}
+	return sizes
+}
+
+// postParts adds the tags and footer to p's text and splits it into the first message or caption
+// and any follow-up text messages.
+func postParts(config *Config, tg TelegramConfig, p *outgoingPost) (text string, parts []string) {
+	text = applyFooter(appendTags(p.Text, p.Tags), footerFor(config, tg, p.Flow))
+	firstLimit := telegramMessageLimit
+	if len(p.Photos) > 0 {
+		firstLimit = telegramCaptionLimit
+		if p.AlbumCaption == albumCaptionNumber {
+			firstLimit -= len("\n10/10")
+		}
+	}
+	parts = splitHTML(text, firstLimit, telegramMessageLimit)
+	if len(parts) == 0 {
+		parts = []string{""} // media without a caption (footer disabled)
+	}
+	return text, parts
+}
+
+// checkAlbumButtons rejects buttons on an album post with no follow-up text message to carry them.
+func checkAlbumButtons(p *outgoingPost, parts []string) error {
+	if len(p.Buttons) > 0 && len(p.Photos) > 1 && len(parts) == 1 {
+		return fmt.Errorf("buttons cannot be attached to an album (Telegram does not support them on media groups)")
+	}
+	return nil
+}
+
+func validAlbumCaption(mode string) bool {
+	switch mode {
+	case "", albumCaptionFirst, albumCaptionRepeat, albumCaptionNumber:
+		return true
+	}
+	return false
+}
+
+// sendPost sends p to its channel (the default one unless p.Channel names a profile), records it in history and returns the resulting message IDs.
+// Text longer than Telegram's limits is split into several messages, with the footer (#cairn by default) on the last one;
+// a caption that does not fit under the media continues in follow-up text messages. More than 10 files
+// are sent as consecutive albums, captioned according to p.AlbumCaption.
+func sendPost(config *Config, p *outgoingPost) ([]int64, error) {
+	tg, err := channelConfig(config, p.Channel)
+	if err != nil {
+		return nil, err
+	}
+	client := newTelegramClient(tg)
+	chatID := tg.ChannelID
+	text, parts := postParts(config, tg, p)
+	rec := postRecord{ChatID: chatID, Action: "send", Text: text, Photos: p.Photos, Flow: p.Flow, PromptPath: p.PromptPath, Model: p.Model}
+	if !validAlbumCaption(p.AlbumCaption) {
+		return nil, fmt.Errorf("unknown album caption mode %q (use first, repeat or number)", p.AlbumCaption)
+	}
+	types, err := mediaTypes(p.Photos, p.MediaType)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Photos) > 1 {
+		if err := checkMediaGroup(p.Photos, types); err != nil {
+			return nil, err
+		}
+	}
+	replyTo := p.ReplyTo
+	if p.ReplyToFlow != "" {
+		if replyTo, err = latestFlowMessage(chatID, p.ReplyToFlow); err != nil {
+			return nil, err
+		}
+	}
+	files, cleanup, err := prepareImages(config.Images, p.Photos, types)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	if err := checkAlbumButtons(p, parts); err != nil {
+		return nil, err
+	}
+	// The reply goes on the first message and buttons on the last: the only one, or the final
+	// text part of a split post.
+	optsFor := func(part int, isText bool) messageOptions {
+		opts := messageOptions{Silent: p.Silent, Protect: p.Protect, NoPreview: p.NoPreview && isText}
+		if part == 0 {
+			opts.ReplyTo = replyTo
+		}
+		if part == len(parts)-1 {
+			opts.Buttons = p.Buttons
+		}
+		return opts
+	}
+	sent := 0
+	// partial keeps what was already posted in history so a half-sent post can be found and fixed.
+	partial := func(err error) ([]int64, error) {
+		if len(rec.MessageIDs) == 0 {
+			return nil, err
+		}
+		recordPost(rec)
+		return rec.MessageIDs, fmt.Errorf("post only partly sent (message_ids: %s): %w", formatMessageIDs(rec.MessageIDs), err)
+	}
+	switch len(p.Photos) {
+	case 0:
+		messageID, err := client.sendMessage(chatID, parts[0], optsFor(0, true))
+		if err != nil {
+			return nil, err
+		}
+		rec.MessageIDs = []int64{messageID}
+		sent++
+	case 1:
+		messageID, err := client.sendMedia(chatID, types[0], files[0], parts[0], optsFor(0, false))
+		if err != nil {
+			return nil, err
+		}
+		rec.MessageIDs = []int64{messageID}
+		sent++
+	default:
+		sizes := albumSizes(len(p.Photos))
+		var groupIDs []string
+		start := 0
+		for i, size := range sizes {
+			caption := ""
+			switch {
+			case p.AlbumCaption == albumCaptionNumber:
+				caption = fmt.Sprintf("%s\n%d/%d", parts[0], i+1, len(sizes))
+			case i == 0 || p.AlbumCaption == albumCaptionRepeat:
+				caption = parts[0]
+			}
+			opts := messageOptions{Silent: p.Silent, Protect: p.Protect}
+			if i == 0 {
+				opts.ReplyTo = replyTo
+			}
+			messageIDs, mediaGroupID, err := client.sendMediaGroup(chatID, files[start:start+size], types[start:start+size], caption, opts)
+			if err != nil {
+				return partial(err)
+			}
+			rec.MessageIDs = append(rec.MessageIDs, messageIDs...)
+			groupIDs = append(groupIDs, mediaGroupID)
+			start += size
+			sent++
+		}
+		rec.MediaGroupID = strings.Join(groupIDs, ",")
+	}
+	for i, part := range parts[1:] {
+		messageID, err := client.sendMessage(chatID, part, optsFor(i+1, true))
+		if err != nil {
+			return partial(err)
+		}
+		rec.MessageIDs = append(rec.MessageIDs, messageID)
+		sent++
+	}
+	if sent > 1 {
+		fmt.Fprintf(os.Stderr, "Post was sent as %d messages/albums (message_ids: %s)\n", sent, formatMessageIDs(rec.MessageIDs))
+	}
+	rec.Buttons = p.Buttons
+	recordPost(rec)
+	return rec.MessageIDs, nil
+}
+
+// broadcastPosts sends the same post to several channels, one outgoingPost per channel, and prints
+// a per-channel report. A failure in one channel does not stop the others; the error lists them all.
+func broadcastPosts(config *Config, posts []*outgoingPost) error {
+	type result struct {
+		messageIDs []int64
+		err        error
+	}
+	results := make([]result, len(posts))
+	var failed []string
+	for i, p := range posts {
+		fmt.Fprintf(os.Stderr, "[%s] ", channelLabel(p.Channel))
+		results[i].messageIDs, results[i].err = sendPost(config, p)
+		if results[i].err != nil {
+			fmt.Fprintf(os.Stderr, "failed: %v\n", results[i].err)
+			failed = append(failed, channelLabel(p.Channel))
+		}
+	}
+	tw := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHANNEL\tRESULT\tMESSAGE IDS")
+	for i, p := range posts {
+		status, ids := "sent", summarizeMessageIDs(results[i].messageIDs)
+		if ids == "" {
+			ids = "-"
+		}
+		switch {
+		case results[i].err != nil && len(results[i].messageIDs) > 0:
+			status = "partly sent"
+		case results[i].err != nil:
+			status = "failed"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", channelLabel(p.Channel), status, ids)
+	}
+	tw.Flush()
+	if len(failed) > 0 {
+		return fmt.Errorf("post failed in %d of %d channels: %s", len(failed), len(posts), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// channelLabel names a channel profile in messages; the default channel has no profile name.
+func channelLabel(name string) string {
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+// editPost replaces the text, caption or (with one file in p.Photos) the media of an existing message,
+// and records the edit in history. Edits cannot be split, so overlong content is rejected.
+// Telegram drops the buttons of a message edited without reply_markup, so unless p gives new
+// buttons or ClearButtons, the ones recorded in history are sent again.
+func editPost(config *Config, messageID int64, p *outgoingPost) error {
+	tg, err := channelConfig(config, p.Channel)
+	if err != nil {
+		return err
+	}
+	client := newTelegramClient(tg)
+	chatID := tg.ChannelID
+	text := applyFooter(appendTags(p.Text, p.Tags), footerFor(config, tg, p.Flow))
+	n := htmlTextLen(text)
+	buttons := p.Buttons
+	if len(buttons) == 0 && !p.ClearButtons {
+		if buttons, err = recordedButtons(chatID, messageID); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to look up the message's buttons, the edit will remove them: %v\n", err)
+		}
+	}
+	opts := messageOptions{Buttons: buttons}
+	switch {
+	case len(p.Photos) == 1:
+		if n > telegramCaptionLimit {
+			return fmt.Errorf("caption is %d characters; Telegram allows %d", n, telegramCaptionLimit)
+		}
+		types, terr := mediaTypes(p.Photos, p.MediaType)
+		if terr != nil {
+			return terr
+		}
+		files, cleanup, perr := prepareImages(config.Images, p.Photos, types)
+		if perr != nil {
+			return perr
+		}
+		defer cleanup()
+		err = client.editMessageMedia(chatID, messageID, types[0], files[0], text, opts)
+	case n > telegramMessageLimit:
+		return fmt.Errorf("message is %d characters; Telegram allows %d", n, telegramMessageLimit)
+	default:
+		err = client.editMessageText(chatID, messageID, text, messageOptions{Buttons: buttons, NoPreview: p.NoPreview})
+		if err != nil && (strings.Contains(err.Error(), "message has no text") || strings.Contains(err.Error(), "no text in the message to edit")) {
+			if n > telegramCaptionLimit {
+				return fmt.Errorf("caption is %d characters; Telegram allows %d", n, telegramCaptionLimit)
+			}
+			err = client.editMessageCaption(chatID, messageID, text, opts)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	recordPost(postRecord{ChatID: chatID, MessageIDs: []int64{messageID}, Action: "edit", Text: text, Photos: p.Photos, Buttons: buttons, Flow: p.Flow})
+	return nil
+}
+
+// editButtons replaces (or with no buttons removes) the inline keyboard of an existing message
+// without touching its text or media.
+func editButtons(config *Config, channel string, messageID int64, buttons [][]inlineButton) error {
+	tg, err := channelConfig(config, channel)
+	if err != nil {
+		return err
+	}
+	if err := newTelegramClient(tg).editMessageReplyMarkup(tg.ChannelID, messageID, buttons); err != nil {
+		return err
+	}
+	recordPost(postRecord{ChatID: tg.ChannelID, MessageIDs: []int64{messageID}, Action: "edit", Buttons: buttons, Flow: "update"})
+	return nil
+}
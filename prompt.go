@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// promptHeader is the optional front-matter of a writer prompt file, in the same "---" (YAML) or
+// "+++" (TOML) block as post files. The rest of the file is the user message.
+type promptHeader struct {
+	// System is the system message.
+	System string `yaml:"system" toml:"system"`
+	// Examples are few-shot user/assistant exchanges sent before the prompt.
+	Examples []promptExample `yaml:"examples" toml:"examples"`
+	// Context files, relative to the prompt file unless absolute, are added to the system message.
+	Context []string `yaml:"context" toml:"context"`
+	// Vars are default values for template variables; --var overrides them.
+	Vars map[string]string `yaml:"vars" toml:"vars"`
+	// Generation settings for this prompt, overriding the provider's.
+	GenerationParams `yaml:",inline"`
+}
+
+// promptExample is one few-shot exchange.
+type promptExample struct {
+	User      string `yaml:"user" toml:"user"`
+	Assistant string `yaml:"assistant" toml:"assistant"`
+}
+
+// prompt is a loaded prompt file, ready to send.
+type prompt struct {
+	Messages []chatMessage
+	Params   GenerationParams
+}
+
+// hasBody reports whether the prompt file had text after its front-matter, i.e. ends with a user message.
+func (p *prompt) hasBody() bool {
+	return len(p.Messages) > 0 && p.Messages[len(p.Messages)-1].Role == "user"
+}
+
+// loadPrompt reads a writer prompt file and builds the conversation to send: the system message
+// with context files, the few-shot examples, then the body, if any, as the user message. Template
+// variables are filled in everywhere except in context files (see expandTemplate).
+func loadPrompt(path string, vars map[string]string) (*prompt, error) {
+	content, err := readFileContent(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read setting file: %w", err)
+	}
+	var h promptHeader
+	block, body, delim, ok := splitFrontMatter(content)
+	if ok {
+		if err := decodeFrontMatter(block, delim, &h); err != nil {
+			return nil, fmt.Errorf("invalid front-matter in %s: %w", path, err)
+		}
+	} else {
+		body = content
+	}
+	if err := h.GenerationParams.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	values := make(map[string]string, len(h.Vars)+len(vars))
+	for k, v := range h.Vars {
+		values[k] = v
+	}
+	for k, v := range vars {
+		values[k] = v
+	}
+	expand := func(s string) (string, error) { return expandTemplate(s, dir, values) }
+
+	system, err := expand(strings.TrimSpace(h.System))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range h.Context {
+		p := name
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read context file: %w", err)
+		}
+		block := fmt.Sprintf("<context file=%q>\n%s\n</context>", name, strings.TrimSpace(string(data)))
+		if system == "" {
+			system = block
+		} else {
+			system += "\n\n" + block
+		}
+	}
+	p := prompt{Params: h.GenerationParams}
+	if system != "" {
+		p.Messages = append(p.Messages, chatMessage{Role: "system", Content: system})
+	}
+	for i, ex := range h.Examples {
+		if strings.TrimSpace(ex.User) == "" || strings.TrimSpace(ex.Assistant) == "" {
+			return nil, fmt.Errorf("example %d in %s needs both user and assistant", i+1, path)
+		}
+		user, err := expand(strings.TrimSpace(ex.User))
+		if err != nil {
+			return nil, err
+		}
+		assistant, err := expand(strings.TrimSpace(ex.Assistant))
+		if err != nil {
+			return nil, err
+		}
+		p.Messages = append(p.Messages, chatMessage{Role: "user", Content: user}, chatMessage{Role: "assistant", Content: assistant})
+	}
+	user, err := expand(strings.TrimSpace(body))
+	if err != nil {
+		return nil, err
+	}
+	if user != "" {
+		p.Messages = append(p.Messages, chatMessage{Role: "user", Content: user})
+	}
+	return &p, nil
+}
+
+// templateVarRe matches the {{{{ escape and placeholders whose NAME is an identifier or starts
+// with "file:" or "env:". Other text in braces, e.g. a Go template's {{ .Name }}, is left alone.
+var templateVarRe = regexp.MustCompile(`\{\{\{\{|\{\{\s*((?:file|env):[^{}]*?|[A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// templateNameRe is what a variable name set with --var or vars must look like.
+var templateNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// expandTemplate fills in {{NAME}} placeholders. A name is looked up in vars (from --var and the
+// prompt's vars), then among the built-ins {{date}} (2006-01-02), {{time}} (15:04) and {{weekday}},
+// then in the environment. {{env:NAME}} reads only the environment and {{file:PATH}} inserts a
+// file, relative to dir unless absolute. Unknown names are an error so typos do not reach the model.
+// {{{{ stands for a literal {{.
+func expandTemplate(s, dir string, vars map[string]string) (string, error) {
+	now := time.Now()
+	var missing []string
+	var fileErr error
+	out := templateVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "{{{{" {
+			return "{{"
+		}
+		name := templateVarRe.FindStringSubmatch(m)[1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		switch {
+		case name == "date":
+			return now.Format("2006-01-02")
+		case name == "time":
+			return now.Format("15:04")
+		case name == "weekday":
+			return now.Weekday().String()
+		case strings.HasPrefix(name, "file:"):
+			p := strings.TrimSpace(strings.TrimPrefix(name, "file:"))
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(dir, p)
+			}
+			data, err := os.ReadFile(p)
+			if err != nil && fileErr == nil {
+				fileErr = fmt.Errorf("failed to read %s: %w", m, err)
+			}
+			return strings.TrimRight(string(data), "\n")
+		}
+		if v, ok := os.LookupEnv(strings.TrimPrefix(name, "env:")); ok {
+			return v
+		}
+		missing = append(missing, name)
+		return m
+	})
+	if fileErr != nil {
+		return "", fileErr
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", fmt.Errorf("template variable(s) not set: %s (use --var NAME=VALUE, vars in the prompt file, or the environment)", strings.Join(uniqueStrings(missing), ", "))
+	}
+	return out, nil
+}
+
+// parseVars turns --var NAME=VALUE flags into a map.
+func parseVars(flags []string) (map[string]string, error) {
+	vars := make(map[string]string, len(flags))
+	for _, f := range flags {
+		name, value, ok := strings.Cut(f, "=")
+		if name = strings.TrimSpace(name); !ok || !templateNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid --var %q (use NAME=VALUE; NAME is letters, digits and _)", f)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.md"), []byte("my notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CAIRN_TEST_CITY", "Lisbon")
+	vars := map[string]string{"topic": "tides", "name_2": "x"}
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"variable", "About {{topic}}.", "About tides.", false},
+		{"spaces inside braces", "{{ topic }} {{name_2}}", "tides x", false},
+		{"environment", "{{CAIRN_TEST_CITY}} {{env:CAIRN_TEST_CITY}}", "Lisbon Lisbon", false},
+		{"file", "Notes: {{file:notes.md}}", "Notes: my notes", false},
+		{"go template left alone", "Hello {{ .Name }} and {{- if .X }}", "Hello {{ .Name }} and {{- if .X }}", false},
+		{"other braces left alone", "{{a-b}} {{1x}} {{}} {{ }}", "{{a-b}} {{1x}} {{}} {{ }}", false},
+		{"escape", "{{{{topic}} is {{topic}}", "{{topic}} is tides", false},
+		{"unset variable", "{{missing_var}}", "", true},
+		{"missing file", "{{file:nope.md}}", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTemplate(tt.in, dir, vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandTemplate(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expandTemplate(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Schedule queue statuses.
+const (
+	queuePending   = "pending"
+	queueSending   = "sending"
+	queueSent      = "sent"
+	queueFailed    = "failed"
+	queueCancelled = "cancelled"
+)
+
+// maxRetryDelay caps the backoff between failed attempts of a scheduled post.
+const maxRetryDelay = time.Hour
+
+// queuedPost is one row of the schedule queue.
+type queuedPost struct {
+	ID         int64
+	DueAt      string
+	Post       outgoingPost
+	Status     string
+	Attempts   int
+	LastError  string
+	MessageIDs []int64
+}
+
+// parseScheduleTime accepts "2006-01-02 15:04", RFC 3339, or "15:04" (today, or tomorrow if already past).
+func parseScheduleTime(s string) (time.Time, error) {
+	now := time.Now()
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Local(), nil
+	}
+	if t, err := time.ParseInLocation("15:04", s, time.Local); err == nil {
+		due := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+		if !due.After(now) {
+			due = due.AddDate(0, 0, 1)
+		}
+		return due, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use \"YYYY-MM-DD HH:MM\", \"HH:MM\" or RFC 3339)", s)
+}
+
+// enqueuePost stores p in the schedule queue to be sent at due by "cairn daemon".
+// Photo paths are made absolute so the daemon can run from any directory, and posts that
+// Telegram would reject in any case are refused now rather than when due.
+func enqueuePost(config *Config, p outgoingPost, due time.Time) (int64, error) {
+	if !due.After(time.Now()) {
+		return 0, fmt.Errorf("scheduled time %s is in the past", due.Format("2006-01-02 15:04"))
+	}
+	for i, photo := range p.Photos {
+		if _, err := os.Stat(photo); err != nil {
+			return 0, fmt.Errorf("cannot schedule photo: %w", err)
+		}
+		abs, err := filepath.Abs(photo)
+		if err != nil {
+			return 0, err
+		}
+		p.Photos[i] = abs
+	}
+	types, err := mediaTypes(p.Photos, p.MediaType)
+	if err != nil {
+		return 0, err
+	}
+	if len(p.Photos) > 1 {
+		if err := checkMediaGroup(p.Photos, types); err != nil {
+			return 0, err
+		}
+	}
+	tg, err := channelConfig(config, p.Channel)
+	if err != nil {
+		return 0, err
+	}
+	_, parts := postParts(config, tg, &p)
+	if err := checkAlbumButtons(&p, parts); err != nil {
+		return 0, err
+	}
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return 0, err
+	}
+	db, err := initHistoryDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	now := time.Now().Format(historyTimeLayout)
+	res, err := db.Exec(`INSERT INTO scheduled (due_at, payload, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		due.Format(historyTimeLayout), string(payload), queuePending, now, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func scanQueuedPosts(rows *sql.Rows) ([]queuedPost, error) {
+	defer rows.Close()
+	var out []queuedPost
+	for rows.Next() {
+		var q queuedPost
+		var payload, lastErr, ids string
+		if err := rows.Scan(&q.ID, &q.DueAt, &payload, &q.Status, &q.Attempts, &lastErr, &ids); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(payload), &q.Post); err != nil {
+			return nil, fmt.Errorf("queue item %d: bad payload: %w", q.ID, err)
+		}
+		q.LastError = lastErr
+		q.MessageIDs = splitMessageIDs(ids)
+		out = append(out, q)
+	}
+	return out, rows.Err()
+}
+
+const queueColumns = `id, due_at, payload, status, attempts, COALESCE(last_error, ''), COALESCE(message_ids, '')`
+
+func listQueue(db *sql.DB, all bool) ([]queuedPost, error) {
+	query := `SELECT ` + queueColumns + ` FROM scheduled`
+	var args []interface{}
+	if !all {
+		query += ` WHERE status IN (?, ?)`
+		args = append(args, queuePending, queueSending)
+	}
+	query += ` ORDER BY due_at, id`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanQueuedPosts(rows)
+}
+
+func dueQueue(db *sql.DB, now time.Time) ([]queuedPost, error) {
+	rows, err := db.Query(`SELECT `+queueColumns+` FROM scheduled WHERE status = ? AND due_at <= ? ORDER BY due_at, id`,
+		queuePending, now.Format(historyTimeLayout))
+	if err != nil {
+		return nil, err
+	}
+	return scanQueuedPosts(rows)
+}
+
+// claimQueued marks a pending item as sending; it returns false if another daemon got there first.
+func claimQueued(db *sql.DB, id int64) (bool, error) {
+	res, err := db.Exec(`UPDATE scheduled SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		queueSending, time.Now().Format(historyTimeLayout), id, queuePending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func retryDelay(attempts int) time.Duration {
+	d := time.Minute << uint(attempts-1)
+	if d <= 0 || d > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return d
+}
+
+// retryableSendError reports whether a failed send may succeed later: a network error, or a
+// Telegram flood-control or server error. Anything else, such as a missing file or a bad chat ID,
+// would fail the same way on every attempt.
+func retryableSendError(err error) bool {
+	var apiErr *TelegramError
+	if errors.As(err, &apiErr) {
+		return apiErr.retryable()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// processQueue sends every due item once. Retryable failures are rescheduled with backoff until
+// maxAttempts; other failures mark the item failed at once.
+func processQueue(config *Config, db *sql.DB, maxAttempts int) error {
+	items, err := dueQueue(db, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, q := range items {
+		ok, err := claimQueued(db, q.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "[queue] Sending #%d (due %s, attempt %d)\n", q.ID, q.DueAt, q.Attempts+1)
+		post := q.Post
+		messageIDs, sendErr := sendPost(config, &post)
+		now := time.Now()
+		if sendErr == nil {
+			_, err = db.Exec(`UPDATE scheduled SET status = ?, attempts = attempts + 1, last_error = NULL, message_ids = ?, updated_at = ? WHERE id = ?`,
+				queueSent, joinMessageIDs(messageIDs), now.Format(historyTimeLayout), q.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		attempts := q.Attempts + 1
+		// A split post that failed part-way must not be retried, or the parts already sent would be duplicated.
+		if attempts >= maxAttempts || len(messageIDs) > 0 || !retryableSendError(sendErr) {
+			fmt.Fprintf(os.Stderr, "[queue] #%d failed permanently after %d attempt(s): %v\n", q.ID, attempts, sendErr)
+			_, err = db.Exec(`UPDATE scheduled SET status = ?, attempts = ?, last_error = ?, message_ids = ?, updated_at = ? WHERE id = ?`,
+				queueFailed, attempts, sendErr.Error(), joinMessageIDs(messageIDs), now.Format(historyTimeLayout), q.ID)
+		} else {
+			next := now.Add(retryDelay(attempts))
+			fmt.Fprintf(os.Stderr, "[queue] #%d failed (%v); retrying at %s\n", q.ID, sendErr, next.Format("2006-01-02 15:04:05"))
+			_, err = db.Exec(`UPDATE scheduled SET status = ?, attempts = ?, last_error = ?, due_at = ?, updated_at = ? WHERE id = ?`,
+				queuePending, attempts, sendErr.Error(), next.Format(historyTimeLayout), now.Format(historyTimeLayout), q.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Daemon runs "cairn daemon": send scheduled posts as they become due until interrupted.
+func Daemon(args []string) error {
+	fs := pflag.NewFlagSet("daemon", pflag.ContinueOnError)
+	configPath := fs.StringP("config", "c", "~/.cairn.toml", "Path to config file")
+	interval := fs.Duration("interval", 30*time.Second, "How often to check the queue for due posts")
+	maxAttempts := fs.Int("max-attempts", 5, "Give up on a post after this many failed attempts")
+	once := fs.Bool("once", false, "Process due posts once and exit (e.g. from cron)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *maxAttempts < 1 {
+		return fmt.Errorf("--max-attempts must be at least 1")
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if err := requireTelegram(config); err != nil {
+		return err
+	}
+	db, err := initHistoryDB()
+	if err != nil {
+		return fmt.Errorf("failed to open queue: %w", err)
+	}
+	defer db.Close()
+	// An item left in "sending" means a previous daemon died mid-send; it may or may not have been posted.
+	res, err := db.Exec(`UPDATE scheduled SET status = ?, last_error = ?, updated_at = ? WHERE status = ?`,
+		queueFailed, "interrupted while sending; check the channel and reschedule if needed", time.Now().Format(historyTimeLayout), queueSending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		fmt.Fprintf(os.Stderr, "[queue] Marked %d interrupted post(s) as failed; see `cairn queue --all`\n", n)
+	}
+	if *once {
+		return processQueue(config, db, *maxAttempts)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "[queue] Daemon started; checking every %s\n", *interval)
+	for {
+		if err := processQueue(config, db, *maxAttempts); err != nil {
+			fmt.Fprintf(os.Stderr, "[queue] Error: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr, "[queue] Daemon stopped")
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// Queue runs "cairn queue": list scheduled posts, or cancel / reschedule one by ID.
+func Queue(args []string) error {
+	fs := pflag.NewFlagSet("queue", pflag.ContinueOnError)
+	all := fs.BoolP("all", "a", false, "Also show sent, failed and cancelled posts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	db, err := initHistoryDB()
+	if err != nil {
+		return fmt.Errorf("failed to open queue: %w", err)
+	}
+	defer db.Close()
+	rest := fs.Args()
+	if len(rest) == 0 || rest[0] == "list" {
+		return printQueue(db, *all)
+	}
+	if len(rest) < 2 {
+		return fmt.Errorf("usage: cairn queue [list] | cancel ID | reschedule ID \"YYYY-MM-DD HH:MM\"")
+	}
+	id, err := strconv.ParseInt(rest[1], 10, 64)
+	if err != nil || id <= 0 {
+		return fmt.Errorf("queue ID must be a positive integer")
+	}
+	now := time.Now().Format(historyTimeLayout)
+	var res sql.Result
+	switch rest[0] {
+	case "cancel":
+		res, err = db.Exec(`UPDATE scheduled SET status = ?, updated_at = ? WHERE id = ? AND status = ?`, queueCancelled, now, id, queuePending)
+	case "reschedule":
+		if len(rest) < 3 {
+			return fmt.Errorf("usage: cairn queue reschedule ID \"YYYY-MM-DD HH:MM\"")
+		}
+		due, perr := parseScheduleTime(rest[2])
+		if perr != nil {
+			return perr
+		}
+		if !due.After(time.Now()) {
+			return fmt.Errorf("scheduled time %s is in the past", due.Format("2006-01-02 15:04"))
+		}
+		res, err = db.Exec(`UPDATE scheduled SET status = ?, due_at = ?, attempts = 0, last_error = NULL, updated_at = ? WHERE id = ? AND status IN (?, ?, ?)`,
+			queuePending, due.Format(historyTimeLayout), now, id, queuePending, queueFailed, queueCancelled)
+	default:
+		return fmt.Errorf("unknown queue command %q (use list, cancel or reschedule)", rest[0])
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no queue item #%d that can be changed (sent posts cannot be cancelled or rescheduled)", id)
+	}
+	fmt.Fprintf(os.Stderr, "Queue item #%d updated\n", id)
+	return nil
+}
+
+func printQueue(db *sql.DB, all bool) error {
+	items, err := listQueue(db, all)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Fprintln(os.Stderr, "Queue is empty")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDUE\tSTATUS\tTRIES\tMESSAGE IDS\tTEXT")
+	for _, q := range items {
+		text := historySnippet(q.Post.Text, 50)
+		if len(q.Post.Photos) > 0 {
+			text = fmt.Sprintf("[%d file(s)] %s", len(q.Post.Photos), text)
+		}
+		if q.Post.Channel != "" {
+			text = "→ " + q.Post.Channel + ": " + text
+		}
+		if q.LastError != "" {
+			text += "  (last error: " + historySnippet(q.LastError, 60) + ")"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", q.ID, q.DueAt, q.Status, q.Attempts, summarizeMessageIDs(q.MessageIDs), text)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Telegram limits, counted in UTF-16 code units after entity parsing (tags do not count).
+const (
+	telegramMessageLimit = 4096
+	telegramCaptionLimit = 1024
+)
+
+// htmlToken is one piece of Telegram HTML: a tag, an entity such as &amp;, or a single character.
+type htmlToken struct {
+	text    string
+	width   int    // visible length in UTF-16 code units; 0 for tags
+	tagName string // lower-case tag name; empty for text and entities
+	closing bool
+}
+
+var (
+	htmlTagRe    = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9-]*)[^<>]*>`)
+	htmlEntityRe = regexp.MustCompile(`^&(#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z][a-zA-Z0-9]*);`)
+)
+
+func tokenizeHTML(s string) []htmlToken {
+	var tokens []htmlToken
+	for len(s) > 0 {
+		switch s[0] {
+		case '<':
+			if m := htmlTagRe.FindStringSubmatch(s); m != nil {
+				tokens = append(tokens, htmlToken{text: m[0], tagName: strings.ToLower(m[1]), closing: strings.HasPrefix(m[0], "</")})
+				s = s[len(m[0]):]
+				continue
+			}
+		case '&':
+			if m := htmlEntityRe.FindString(s); m != "" {
+				tokens = append(tokens, htmlToken{text: m, width: 1})
+				s = s[len(m):]
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		tokens = append(tokens, htmlToken{text: s[:size], width: len(utf16.Encode([]rune{r}))})
+		s = s[size:]
+	}
+	return tokens
+}
+
+func (t htmlToken) isSpace() bool {
+	return t.tagName == "" && t.width > 0 && strings.TrimSpace(t.text) == ""
+}
+
+// htmlTextLen returns the visible length of Telegram HTML as Telegram counts it against its limits.
+func htmlTextLen(s string) int {
+	n := 0
+	for _, t := range tokenizeHTML(s) {
+		n += t.width
+	}
+	return n
+}
+
+// splitHTML splits Telegram HTML into parts whose visible length is at most firstLimit for the
+// first part and limit for the rest. It never cuts inside a tag or entity; tags still open at a
+// cut are closed at the end of the part and reopened at the start of the next. Cuts prefer a
+// line break, then a space, and fall back to a hard cut only for very long words.
+func splitHTML(text string, firstLimit, limit int) []string {
+	tokens := tokenizeHTML(text)
+	type breakPoint struct {
+		idx   int
+		width int
+		open  []htmlToken
+	}
+	var parts []string
+	var open, chunkOpen []htmlToken
+	var lastLine, lastSpace *breakPoint
+	chunkStart, width, maxWidth := 0, 0, firstLimit
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.width > 0 && width > 0 && width+t.width > maxWidth {
+			cut, cutOpen := i, open
+			switch {
+			case lastLine != nil && lastLine.width >= maxWidth/2:
+				cut, cutOpen = lastLine.idx, lastLine.open
+			case lastSpace != nil:
+				cut, cutOpen = lastSpace.idx, lastSpace.open
+			case lastLine != nil:
+				cut, cutOpen = lastLine.idx, lastLine.open
+			}
+			if part := renderHTMLChunk(tokens[chunkStart:cut], chunkOpen, cutOpen); part != "" {
+				parts = append(parts, part)
+			}
+			for cut < len(tokens) && tokens[cut].isSpace() {
+				cut++
+			}
+			chunkStart, chunkOpen = cut, cutOpen
+			open = append([]htmlToken(nil), cutOpen...)
+			width, maxWidth = 0, limit
+			lastLine, lastSpace = nil, nil
+			i = cut - 1
+			continue
+		}
+		width += t.width
+		switch {
+		case t.tagName != "" && !t.closing:
+			open = append(append([]htmlToken(nil), open...), t)
+		case t.tagName != "" && t.closing:
+			for j := len(open) - 1; j >= 0; j-- {
+				if open[j].tagName == t.tagName {
+					open = append(append([]htmlToken(nil), open[:j]...), open[j+1:]...)
+					break
+				}
+			}
+		case t.isSpace():
+			bp := &breakPoint{idx: i + 1, width: width, open: open}
+			if strings.Contains(t.text, "\n") {
+				lastLine = bp
+			} else {
+				lastSpace = bp
+			}
+		}
+	}
+	if part := renderHTMLChunk(tokens[chunkStart:], chunkOpen, open); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// renderHTMLChunk joins tokens, reopening the tags in reopen first and closing those in closeTags last.
+func renderHTMLChunk(tokens, reopen, closeTags []htmlToken) string {
+	last := len(tokens) - 1
+	for last >= 0 && (tokens[last].isSpace() || tokens[last].width == 0) {
+		last--
+	}
+	var body strings.Builder
+	for i, t := range tokens {
+		if i > last && t.isSpace() {
+			continue
+		}
+		body.WriteString(t.text)
+	}
+	if strings.IndexFunc(body.String(), func(r rune) bool { return !unicode.IsSpace(r) }) < 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, t := range reopen {
+		b.WriteString(t.text)
+	}
+	b.WriteString(body.String())
+	for j := len(closeTags) - 1; j >= 0; j-- {
+		b.WriteString("</" + closeTags[j].tagName + ">")
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHTMLTextLen(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"empty", "", 0},
+		{"plain", "hello", 5},
+		{"tags do not count", `<b>bold</b> <a href="https://example.com">link</a>`, 9},
+		{"entity is one character", "&amp;&lt;&#39;&#x27;", 4},
+		{"stray ampersand", "a & b", 5},
+		{"non-ASCII in the BMP", "héllo", 5},
+		{"astral rune is two UTF-16 units", "😀", 2},
+		{"mixed", "<i>a</i>&amp;😀", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := htmlTextLen(tt.in); got != tt.want {
+				t.Errorf("htmlTextLen(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitHTML(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		firstLimit int
+		limit      int
+		want       []string
+	}{
+		{
+			name: "fits", in: "short text", firstLimit: 20, limit: 20,
+			want: []string{"short text"},
+		},
+		{
+			name: "empty", in: "", firstLimit: 20, limit: 20,
+			want: nil,
+		},
+		{
+			name: "prefers a line break", in: "first line\nsecond part here", firstLimit: 20, limit: 20,
+			want: []string{"first line", "second part here"},
+		},
+		{
+			name: "then a space", in: "one two three four", firstLimit: 10, limit: 10,
+			want: []string{"one two", "three four"},
+		},
+		{
+			name: "does not cut inside a tag", in: "aaaa <b>bbbb</b>", firstLimit: 6, limit: 6,
+			want: []string{"aaaa", "<b>bbbb</b>"},
+		},
+		{
+			name: "does not cut inside an entity", in: "&amp;&amp;&amp;&amp;", firstLimit: 2, limit: 2,
+			want: []string{"&amp;&amp;", "&amp;&amp;"},
+		},
+		{
+			name: "closes and reopens tags", in: "<b>aaa bbb</b>", firstLimit: 4, limit: 4,
+			want: []string{"<b>aaa</b>", "<b>bbb</b>"},
+		},
+		{
+			name: "reopens nested tags with attributes", in: `<a href="https://x.example"><i>one two</i></a>`, firstLimit: 4, limit: 4,
+			want: []string{`<a href="https://x.example"><i>one</i></a>`, `<a href="https://x.example"><i>two</i></a>`},
+		},
+		{
+			name: "tags closed before the cut are not reopened", in: "<b>aa</b> cc dd", firstLimit: 5, limit: 5,
+			want: []string{"<b>aa</b>", "cc dd"},
+		},
+		{
+			name: "limits count UTF-16 units", in: "😀😀😀", firstLimit: 4, limit: 4,
+			want: []string{"😀😀", "😀"},
+		},
+		{
+			name: "first limit differs from the rest", in: "aa bb cc", firstLimit: 2, limit: 5,
+			want: []string{"aa", "bb cc"},
+		},
+		{
+			name: "hard cut for a long word", in: "abcdefgh", firstLimit: 3, limit: 3,
+			want: []string{"abc", "def", "gh"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitHTML(tt.in, tt.firstLimit, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitHTML(%q, %d, %d) = %q, want %q", tt.in, tt.firstLimit, tt.limit, got, tt.want)
+			}
+			for i, part := range got {
+				max := tt.limit
+				if i == 0 {
+					max = tt.firstLimit
+				}
+				if n := htmlTextLen(part); n > max {
+					t.Errorf("part %d is %d characters, limit %d", i, n, max)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitHTMLKeepsFooterOnLastPart(t *testing.T) {
+	footer := FooterConfig{Tags: []string{"#cairn"}, Signature: "— Yet"}
+	text := applyFooter(strings.TrimSpace(strings.Repeat("<b>word</b> ", 40)), footer)
+	parts := splitHTML(text, 50, 60)
+	if len(parts) < 2 {
+		t.Fatalf("expected several parts, got %q", parts)
+	}
+	last := parts[len(parts)-1]
+	if !strings.HasSuffix(last, "#cairn\n— Yet") {
+		t.Errorf("last part %q does not end with the footer", last)
+	}
+	for i, part := range parts[:len(parts)-1] {
+		if strings.Contains(part, "#cairn") || strings.Contains(part, "— Yet") {
+			t.Errorf("part %d %q contains the footer", i, part)
+		}
+	}
+	if got := strings.Count(strings.Join(parts, ""), "<b>"); got != strings.Count(text, "<b>") {
+		t.Errorf("%d <b> tags after splitting, want %d", got, strings.Count(text, "<b>"))
+	}
+}
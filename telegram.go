@@ -2,11 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -14,368 +17,512 @@ import (
 	"time"
 )
 
-// TelegramResponse is the common response from Telegram Bot API.
+const (
+	defaultTelegramAPIURL        = "https://api.telegram.org"
+	defaultTelegramTimeout       = 10 * time.Second
+	defaultTelegramUploadTimeout = 60 * time.Second
+	defaultTelegramMaxRetries    = 3
+	defaultTelegramRetryBackoff  = time.Second
+	defaultTelegramMaxRetryWait  = 60 * time.Second
+)
+
+// TelegramResponse is the common response envelope from the Telegram Bot API.
 type TelegramResponse struct {
 	OK          bool   `json:"ok"`
 	Description string `json:"description,omitempty"`
-	Result      *struct {
-		MessageID int64 `json:"message_id"`
-	} `json:"result,omitempty"`
+	ErrorCode   int    `json:"error_code,omitempty"`
+	Parameters  *struct {
+		RetryAfter      int   `json:"retry_after,omitempty"`
+		MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"`
+	} `json:"parameters,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
 }
 
-// telegramMediaGroupResponse is the response from sendMediaGroup (result is array of Message).
-type telegramMediaGroupResponse struct {
-	OK          bool   `json:"ok"`
-	Description string `json:"description,omitempty"`
-	Result      []struct {
-		MessageID int64 `json:"message_id"`
-	} `json:"result,omitempty"`
+// telegramMessage is the part of a Bot API Message that cairn uses.
+type telegramMessage struct {
+	MessageID    int64  `json:"message_id"`
+	MediaGroupID string `json:"media_group_id,omitempty"`
+}
+
+// TelegramError is an unsuccessful Bot API call (ok=false or a non-JSON HTTP error).
+type TelegramError struct {
+	Method      string
+	StatusCode  int
+	ErrorCode   int
+	Description string
+	// RetryAfter is parameters.retry_after in seconds (set on 429 flood-control errors).
+	RetryAfter int
 }
 
-func ensureCairnTag(content string) string {
-	contentLower := strings.ToLower(content)
-	if strings.Contains(contentLower, "#cairn") {
-		return content
+func (e *TelegramError) Error() string {
+	msg := fmt.Sprintf("telegram API error: %s", e.Description)
+	if e.ErrorCode != 0 {
+		msg = fmt.Sprintf("telegram API error %d: %s", e.ErrorCode, e.Description)
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %ds)", e.RetryAfter)
+	}
+	return msg
+}
+
+// retryable reports whether the call may succeed if repeated: flood control (429) or a server error (5xx).
+func (e *TelegramError) retryable() bool {
+	return e.ErrorCode == http.StatusTooManyRequests || e.StatusCode == http.StatusTooManyRequests ||
+		e.ErrorCode >= 500 || e.StatusCode >= 500
+}
+
+// telegramFile is a local file attached to a multipart request under the given form field.
+type telegramFile struct {
+	Field string
+	Path  string
+}
+
+// TelegramClient calls the Telegram Bot API for one bot token.
+type TelegramClient struct {
+	// BaseURL is the Bot API server, e.g. "https://api.telegram.org" or a local stand-in for testing.
+	BaseURL string
+	Token   string
+	// Timeout applies to JSON requests, UploadTimeout to multipart file uploads.
+	Timeout       time.Duration
+	UploadTimeout time.Duration
+	// MaxRetries is how many times a 429 or 5xx response is retried (0 disables retries).
+	// The wait is parameters.retry_after when given, else RetryBackoff doubled per attempt;
+	// a call whose wait would exceed MaxRetryWait fails instead of sleeping.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	MaxRetryWait time.Duration
+	HTTPClient   *http.Client
+}
+
+// newTelegramClient builds a client from the [telegram] config section, filling in defaults.
+func newTelegramClient(cfg TelegramConfig) *TelegramClient {
+	c := &TelegramClient{
+		BaseURL:       strings.TrimRight(cfg.APIURL, "/"),
+		Token:         cfg.BotToken,
+		Timeout:       time.Duration(cfg.Timeout) * time.Second,
+		UploadTimeout: time.Duration(cfg.UploadTimeout) * time.Second,
+		MaxRetries:    defaultTelegramMaxRetries,
+		RetryBackoff:  time.Duration(cfg.RetryBackoff * float64(time.Second)),
+		MaxRetryWait:  time.Duration(cfg.MaxRetryWait) * time.Second,
+		HTTPClient:    &http.Client{},
+	}
+	if cfg.MaxRetries != nil && *cfg.MaxRetries >= 0 {
+		c.MaxRetries = *cfg.MaxRetries
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = defaultTelegramRetryBackoff
+	}
+	if c.MaxRetryWait <= 0 {
+		c.MaxRetryWait = defaultTelegramMaxRetryWait
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = defaultTelegramAPIURL
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTelegramTimeout
 	}
-	content = strings.TrimRight(content, " \n\t")
-	if content != "" {
-		return content + " #cairn"
+	if c.UploadTimeout <= 0 {
+		c.UploadTimeout = defaultTelegramUploadTimeout
 	}
-	return "#cairn"
+	return c
 }
 
-func httpPost(url string, jsonData []byte) (*http.Response, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+// call sends a JSON request to method and decodes the result into result (if non-nil).
+func (c *TelegramClient) call(method string, payload map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return c.do(method, "application/json", body, c.Timeout, result)
+}
+
+// callMultipart sends form fields and files to method and decodes the result into result (if non-nil).
+func (c *TelegramClient) callMultipart(method string, fields map[string]string, files []telegramFile, result interface{}) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		if err := attachFile(writer, f); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return c.do(method, writer.FormDataContentType(), body.Bytes(), c.UploadTimeout, result)
+}
+
+func attachFile(writer *multipart.Writer, f telegramFile) error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", f.Path, err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
+	defer file.Close()
+	part, err := writer.CreateFormFile(f.Field, filepath.Base(f.Path))
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to create form file: %w", err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, fmt.Errorf("HTTP error: %d: %s", resp.StatusCode, string(body))
+	if _, err := io.Copy(part, file); err != nil {
+		return fmt.Errorf("failed to read file %s: %w", f.Path, err)
 	}
-	return resp, nil
+	return nil
 }
 
-func postToTelegram(botToken, channelID, content string) (messageID int64, err error) {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botToken)
-	content = ensureCairnTag(content)
-	payload := map[string]interface{}{
-		"chat_id":    channelID,
-		"text":       content,
-		"parse_mode": "HTML",
+// do is the single request/response path for every Bot API call. Flood-control (429) and
+// server (5xx) errors are retried with backoff; each retry is logged to stderr.
+func (c *TelegramClient) do(method, contentType string, body []byte, timeout time.Duration, result interface{}) error {
+	for attempt := 0; ; attempt++ {
+		err := c.doOnce(method, contentType, body, timeout, result)
+		var apiErr *TelegramError
+		if err == nil || attempt >= c.MaxRetries || !errors.As(err, &apiErr) || !apiErr.retryable() {
+			return err
+		}
+		wait := c.RetryBackoff << uint(attempt)
+		if apiErr.RetryAfter > 0 {
+			wait = time.Duration(apiErr.RetryAfter) * time.Second
+		}
+		if wait > c.MaxRetryWait {
+			return fmt.Errorf("%w; not retrying, wait of %s exceeds max_retry_wait", err, wait)
+		}
+		fmt.Fprintf(os.Stderr, "[telegram] %s: %v; retrying in %s (retry %d/%d)\n", method, err, wait, attempt+1, c.MaxRetries)
+		time.Sleep(wait)
 	}
-	jsonData, err := json.Marshal(payload)
+}
+
+func (c *TelegramClient) doOnce(method, contentType string, body []byte, timeout time.Duration, result interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/bot"+c.Token+"/"+method, bytes.NewReader(body))
 	if err != nil {
-		return 0, fmt.Errorf("failed to marshal payload: %w", err)
+		return err
 	}
-	resp, err := httpPost(url, jsonData)
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to post to Telegram: %w", err)
+		// url.Error includes the request URL, which contains the bot token.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: request failed: %w", method, err)
 	}
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read response: %w", err)
+		return fmt.Errorf("telegram %s: failed to read response: %w", method, err)
 	}
 	var telegramResp TelegramResponse
-	if err := json.Unmarshal(body, &telegramResp); err != nil {
-		return 0, fmt.Errorf("failed to parse response: %w", err)
+	if err := json.Unmarshal(respBody, &telegramResp); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &TelegramError{Method: method, StatusCode: resp.StatusCode, ErrorCode: resp.StatusCode,
+				Description: fmt.Sprintf("HTTP error: %s", strings.TrimSpace(string(respBody)))}
+		}
+		return fmt.Errorf("telegram %s: failed to parse response: %w", method, err)
 	}
 	if !telegramResp.OK {
-		return 0, fmt.Errorf("telegram API error: %s", telegramResp.Description)
+		apiErr := &TelegramError{Method: method, StatusCode: resp.StatusCode, ErrorCode: telegramResp.ErrorCode, Description: telegramResp.Description}
+		if telegramResp.Parameters != nil {
+			apiErr.RetryAfter = telegramResp.Parameters.RetryAfter
+		}
+		return apiErr
 	}
-	if telegramResp.Result != nil {
-		messageID = telegramResp.Result.MessageID
-		fmt.Fprintf(os.Stderr, "Successfully posted to Telegram channel (message_id: %d)\n", messageID)
-	} else {
-		fmt.Fprintln(os.Stderr, "Successfully posted to Telegram channel")
+	if result != nil && len(telegramResp.Result) > 0 {
+		if err := json.Unmarshal(telegramResp.Result, result); err != nil {
+			return fmt.Errorf("telegram %s: failed to parse result: %w", method, err)
+		}
 	}
-	return messageID, nil
+	return nil
 }
 
-func editMessageTelegram(botToken, channelID string, messageID int64, content string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/editMessageText", botToken)
-	content = ensureCairnTag(content)
+// messageOptions are optional parameters shared by the send and edit methods.
+type messageOptions struct {
+	// Buttons are inline keyboard rows of URL buttons, sent as reply_markup.
+	Buttons [][]inlineButton
+	// Silent sends without a notification sound (disable_notification).
+	Silent bool
+	// Protect forbids forwarding and saving the message (protect_content).
+	Protect bool
+	// NoPreview turns off the link preview of a text message (link_preview_options).
+	NoPreview bool
+	// ReplyTo is the message ID this message replies to (reply_parameters); 0 for none.
+	ReplyTo int64
+}
+
+// addTo sets the options on a JSON payload.
+func (o messageOptions) addTo(payload map[string]interface{}) {
+	if len(o.Buttons) > 0 {
+		payload["reply_markup"] = inlineKeyboard{InlineKeyboard: o.Buttons}
+	}
+	if o.Silent {
+		payload["disable_notification"] = true
+	}
+	if o.Protect {
+		payload["protect_content"] = true
+	}
+	if o.NoPreview {
+		payload["link_preview_options"] = map[string]bool{"is_disabled": true}
+	}
+	if o.ReplyTo != 0 {
+		payload["reply_parameters"] = map[string]int64{"message_id": o.ReplyTo}
+	}
+}
+
+// addFields sets the options on multipart form fields, where objects are JSON-encoded.
+func (o messageOptions) addFields(fields map[string]string) error {
+	payload := map[string]interface{}{}
+	o.addTo(payload)
+	for k, v := range payload {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", k, err)
+		}
+		fields[k] = string(b)
+	}
+	return nil
+}
+
+func (c *TelegramClient) sendMessage(chatID, content string, opts messageOptions) (messageID int64, err error) {
+	var msg telegramMessage
 	payload := map[string]interface{}{
-		"chat_id":    channelID,
-		"message_id": messageID,
+		"chat_id":    chatID,
 		"text":       content,
 		"parse_mode": "HTML",
 	}
-	jsonData, err := json.Marshal(payload)
+	opts.addTo(payload)
+	err = c.call("sendMessage", payload, &msg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return 0, fmt.Errorf("failed to post to Telegram: %w", err)
 	}
-	resp, err := httpPost(url, jsonData)
-	if err != nil {
-		return fmt.Errorf("failed to edit message: %w", err)
+	fmt.Fprintf(os.Stderr, "Successfully posted to Telegram channel (message_id: %d)\n", msg.MessageID)
+	return msg.MessageID, nil
+}
+
+func (c *TelegramClient) editMessageText(chatID string, messageID int64, content string, opts messageOptions) error {
+	payload := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       content,
+		"parse_mode": "HTML",
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	opts.addTo(payload)
+	err := c.call("editMessageText", payload, nil)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
-	}
-	var telegramResp TelegramResponse
-	if err := json.Unmarshal(body, &telegramResp); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
-	}
-	if !telegramResp.OK {
-		return fmt.Errorf("telegram API error: %s", telegramResp.Description)
+		return fmt.Errorf("failed to edit message: %w", err)
 	}
 	fmt.Fprintln(os.Stderr, "Successfully updated message")
 	return nil
 }
 
-func editMessageCaptionTelegram(botToken, channelID string, messageID int64, caption string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/editMessageCaption", botToken)
-	caption = ensureCairnTag(caption)
+func (c *TelegramClient) editMessageCaption(chatID string, messageID int64, caption string, opts messageOptions) error {
 	payload := map[string]interface{}{
-		"chat_id":    channelID,
+		"chat_id":    chatID,
 		"message_id": messageID,
 		"caption":    caption,
 		"parse_mode": "HTML",
 	}
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
-	}
-	resp, err := httpPost(url, jsonData)
+	opts.addTo(payload)
+	err := c.call("editMessageCaption", payload, nil)
 	if err != nil {
 		return fmt.Errorf("failed to edit caption: %w", err)
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
-	}
-	var telegramResp TelegramResponse
-	if err := json.Unmarshal(body, &telegramResp); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
-	}
-	if !telegramResp.OK {
-		return fmt.Errorf("telegram API error: %s", telegramResp.Description)
-	}
 	fmt.Fprintln(os.Stderr, "Successfully updated caption")
 	return nil
 }
 
-func editMessageMediaTelegram(botToken, channelID string, messageID int64, photoPath, caption string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/editMessageMedia", botToken)
-	photoFile, err := os.Open(photoPath)
+// editMessageReplyMarkup replaces the inline keyboard of a message; no buttons removes it.
+func (c *TelegramClient) editMessageReplyMarkup(chatID string, messageID int64, buttons [][]inlineButton) error {
+	if buttons == nil {
+		buttons = [][]inlineButton{}
+	}
+	err := c.call("editMessageReplyMarkup", map[string]interface{}{
+		"chat_id":      chatID,
+		"message_id":   messageID,
+		"reply_markup": inlineKeyboard{InlineKeyboard: buttons},
+	}, nil)
 	if err != nil {
-		return fmt.Errorf("failed to open photo file: %w", err)
-	}
-	defer photoFile.Close()
-	caption = ensureCairnTag(caption)
-	if caption == "" {
-		caption = "#cairn"
+		return fmt.Errorf("failed to edit buttons: %w", err)
 	}
-	media := map[string]string{
-		"type":       "photo",
-		"media":      "attach://photo0",
+	fmt.Fprintln(os.Stderr, "Successfully updated buttons")
+	return nil
+}
+
+// editMessageMedia replaces the file of an existing message; mediaType is one of the media* constants except voice.
+func (c *TelegramClient) editMessageMedia(chatID string, messageID int64, mediaType, path, caption string, opts messageOptions) error {
+	if mediaType == mediaVoice {
+		return fmt.Errorf("telegram cannot replace a message's media with a voice note; send it as audio (--as audio)")
+	}
+	mediaJSON, err := json.Marshal(map[string]string{
+		"type":       mediaType,
+		"media":      "attach://file0",
 		"caption":    caption,
 		"parse_mode": "HTML",
-	}
-	mediaJSON, err := json.Marshal(media)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to marshal media: %w", err)
 	}
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-	for _, field := range []struct{ name, value string }{
-		{"chat_id", channelID},
-		{"message_id", strconv.FormatInt(messageID, 10)},
-		{"media", string(mediaJSON)},
-	} {
-		f, _ := writer.CreateFormField(field.name)
-		f.Write([]byte(field.value))
-	}
-	photoField, err := writer.CreateFormFile("photo0", filepath.Base(photoPath))
-	if err != nil {
-		return fmt.Errorf("failed to create form file: %w", err)
-	}
-	if _, err := io.Copy(photoField, photoFile); err != nil {
-		return fmt.Errorf("failed to copy photo: %w", err)
+	fields := map[string]string{
+		"chat_id":    chatID,
+		"message_id": strconv.FormatInt(messageID, 10),
+		"media":      string(mediaJSON),
 	}
-	writer.Close()
-	req, err := http.NewRequest("POST", url, &requestBody)
-	if err != nil {
+	if err := opts.addFields(fields); err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	err = c.callMultipart("editMessageMedia", fields, []telegramFile{{Field: "file0", Path: path}}, nil)
 	if err != nil {
 		return fmt.Errorf("failed to edit media: %w", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP error: %d: %s", resp.StatusCode, string(body))
-	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	var telegramResp TelegramResponse
-	if err := json.Unmarshal(body, &telegramResp); err != nil {
-		return err
-	}
-	if !telegramResp.OK {
-		return fmt.Errorf("telegram API error: %s", telegramResp.Description)
-	}
-	fmt.Fprintln(os.Stderr, "Successfully replaced photo")
+	fmt.Fprintf(os.Stderr, "Successfully replaced %s\n", mediaType)
 	return nil
 }
 
-func postPhotoToTelegram(botToken, channelID, photoPath, caption string) (messageID int64, err error) {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendPhoto", botToken)
-	photoFile, err := os.Open(photoPath)
-	if err != nil {
-		return 0, fmt.Errorf("failed to open photo file: %w", err)
-	}
-	defer photoFile.Close()
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-	chatIDField, _ := writer.CreateFormField("chat_id")
-	chatIDField.Write([]byte(channelID))
-	if caption != "" {
-		caption = ensureCairnTag(caption)
-	} else {
-		caption = "#cairn"
-	}
-	captionField, _ := writer.CreateFormField("caption")
-	captionField.Write([]byte(caption))
-	parseModeField, _ := writer.CreateFormField("parse_mode")
-	parseModeField.Write([]byte("HTML"))
-	photoField, err := writer.CreateFormFile("photo", filepath.Base(photoPath))
-	if err != nil {
-		return 0, fmt.Errorf("failed to create form file: %w", err)
+// sendMedia posts one file with sendPhoto, sendVideo, sendAnimation, sendAudio, sendVoice or sendDocument.
+func (c *TelegramClient) sendMedia(chatID, mediaType, path, caption string, opts messageOptions) (messageID int64, err error) {
+	var msg telegramMessage
+	method := "send" + strings.ToUpper(mediaType[:1]) + mediaType[1:]
+	fields := map[string]string{
+		"chat_id":    chatID,
+		"caption":    caption,
+		"parse_mode": "HTML",
 	}
-	io.Copy(photoField, photoFile)
-	writer.Close()
-	req, err := http.NewRequest("POST", url, &requestBody)
-	if err != nil {
+	if err := opts.addFields(fields); err != nil {
 		return 0, err
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	err = c.callMultipart(method, fields, []telegramFile{{Field: mediaType, Path: path}}, &msg)
 	if err != nil {
 		return 0, fmt.Errorf("failed to post to Telegram: %w", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("HTTP error: %d: %s", resp.StatusCode, string(body))
+	fmt.Fprintf(os.Stderr, "Successfully posted %s to Telegram channel (message_id: %d)\n", mediaType, msg.MessageID)
+	return msg.MessageID, nil
+}
+
+// sendMediaGroup posts 2-10 files as one album; types[i] is the media type of paths[i] (see checkMediaGroup).
+// Telegram does not support buttons on albums, so opts.Buttons must be empty.
+func (c *TelegramClient) sendMediaGroup(chatID string, paths, types []string, caption string, opts messageOptions) (messageIDs []int64, mediaGroupID string, err error) {
+	if len(paths) > 10 {
+		return nil, "", fmt.Errorf("maximum 10 files per album, got %d", len(paths))
+	}
+	if err := checkMediaGroup(paths, types); err != nil {
+		return nil, "", err
+	}
+	media := make([]map[string]interface{}, len(paths))
+	files := make([]telegramFile, len(paths))
+	for i, path := range paths {
+		field := fmt.Sprintf("file%d", i)
+		media[i] = map[string]interface{}{
+			"type":  types[i],
+			"media": "attach://" + field,
+		}
+		if i == 0 && caption != "" {
+			media[i]["caption"] = caption
+			media[i]["parse_mode"] = "HTML"
+		}
+		files[i] = telegramFile{Field: field, Path: path}
 	}
-	body, err := io.ReadAll(resp.Body)
+	mediaJSON, err := json.Marshal(media)
 	if err != nil {
-		return 0, err
+		return nil, "", fmt.Errorf("failed to marshal media: %w", err)
 	}
-	var telegramResp TelegramResponse
-	if err := json.Unmarshal(body, &telegramResp); err != nil {
-		return 0, err
+	var msgs []telegramMessage
+	fields := map[string]string{
+		"chat_id": chatID,
+		"media":   string(mediaJSON),
 	}
-	if !telegramResp.OK {
-		return 0, fmt.Errorf("telegram API error: %s", telegramResp.Description)
+	if err := opts.addFields(fields); err != nil {
+		return nil, "", err
 	}
-	if telegramResp.Result != nil {
-		messageID = telegramResp.Result.MessageID
-		fmt.Fprintf(os.Stderr, "Successfully posted photo to Telegram channel (message_id: %d)\n", messageID)
-	} else {
-		fmt.Fprintln(os.Stderr, "Successfully posted photo to Telegram channel")
+	err = c.callMultipart("sendMediaGroup", fields, files, &msgs)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to post to Telegram: %w", err)
+	}
+	for _, m := range msgs {
+		messageIDs = append(messageIDs, m.MessageID)
 	}
-	return messageID, nil
+	if len(msgs) > 0 {
+		mediaGroupID = msgs[0].MediaGroupID
+	}
+	fmt.Fprintf(os.Stderr, "Successfully posted %d file(s) to Telegram channel (message_ids: %s)\n", len(paths), formatMessageIDs(messageIDs))
+	return messageIDs, mediaGroupID, nil
 }
 
-func postMultiplePhotosToTelegram(botToken, channelID string, photoPaths []string, caption string) (firstMessageID int64, err error) {
-	if len(photoPaths) > 10 {
-		return 0, fmt.Errorf("maximum 10 photos allowed, got %d", len(photoPaths))
-	}
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMediaGroup", botToken)
-	if caption != "" {
-		caption = ensureCairnTag(caption)
-	} else {
-		caption = "#cairn"
-	}
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-	chatIDField, _ := writer.CreateFormField("chat_id")
-	chatIDField.Write([]byte(channelID))
-	media := make([]map[string]interface{}, len(photoPaths))
-	for i := range photoPaths {
-		filename := fmt.Sprintf("photo%d", i)
-		mediaItem := map[string]interface{}{
-			"type":  "photo",
-			"media": fmt.Sprintf("attach://%s", filename),
-		}
-		if i == 0 {
-			mediaItem["caption"] = caption
-		}
-		media[i] = mediaItem
-	}
-	mediaJSON, _ := json.Marshal(media)
-	mediaField, _ := writer.CreateFormField("media")
-	mediaField.Write(mediaJSON)
-	parseModeField, _ := writer.CreateFormField("parse_mode")
-	parseModeField.Write([]byte("HTML"))
-	for i, photoPath := range photoPaths {
-		photoFile, err := os.Open(photoPath)
-		if err != nil {
-			return 0, fmt.Errorf("failed to open photo file %s: %w", photoPath, err)
+// maxDeleteBatch is how many message IDs deleteMessages accepts per call.
+const maxDeleteBatch = 100
+
+// deleteMessages deletes messageIDs from the chat, in batches of 100. Messages that no longer
+// exist are skipped by Telegram; bots can delete any channel post only as an admin.
+func (c *TelegramClient) deleteMessages(chatID string, messageIDs []int64) error {
+	for start := 0; start < len(messageIDs); start += maxDeleteBatch {
+		end := start + maxDeleteBatch
+		if end > len(messageIDs) {
+			end = len(messageIDs)
 		}
-		photoField, err := writer.CreateFormFile(fmt.Sprintf("photo%d", i), filepath.Base(photoPath))
+		err := c.call("deleteMessages", map[string]interface{}{
+			"chat_id":     chatID,
+			"message_ids": messageIDs[start:end],
+		}, nil)
 		if err != nil {
-			photoFile.Close()
-			return 0, err
+			return fmt.Errorf("failed to delete messages: %w", adminRightsError(err, chatID, "Delete messages"))
 		}
-		io.Copy(photoField, photoFile)
-		photoFile.Close()
 	}
-	writer.Close()
-	req, err := http.NewRequest("POST", url, &requestBody)
+	fmt.Fprintf(os.Stderr, "Successfully deleted %d message(s) (message_ids: %s)\n", len(messageIDs), formatMessageIDs(messageIDs))
+	return nil
+}
+
+// pinChatMessage pins a message; with silent, subscribers get no notification.
+func (c *TelegramClient) pinChatMessage(chatID string, messageID int64, silent bool) error {
+	err := c.call("pinChatMessage", map[string]interface{}{
+		"chat_id":              chatID,
+		"message_id":           messageID,
+		"disable_notification": silent,
+	}, nil)
 	if err != nil {
-		return 0, err
+		return fmt.Errorf("failed to pin message: %w", adminRightsError(err, chatID, "Edit messages"))
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, err
+	fmt.Fprintf(os.Stderr, "Successfully pinned message %d\n", messageID)
+	return nil
+}
+
+// unpinChatMessage unpins a message, or the most recently pinned one if messageID is 0.
+func (c *TelegramClient) unpinChatMessage(chatID string, messageID int64) error {
+	payload := map[string]interface{}{"chat_id": chatID}
+	if messageID != 0 {
+		payload["message_id"] = messageID
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("HTTP error: %d: %s", resp.StatusCode, string(body))
+	if err := c.call("unpinChatMessage", payload, nil); err != nil {
+		return fmt.Errorf("failed to unpin message: %w", adminRightsError(err, chatID, "Edit messages"))
 	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
+	if messageID != 0 {
+		fmt.Fprintf(os.Stderr, "Successfully unpinned message %d\n", messageID)
+	} else {
+		fmt.Fprintln(os.Stderr, "Successfully unpinned the most recent pinned message")
 	}
-	var mediaResp telegramMediaGroupResponse
-	if err := json.Unmarshal(body, &mediaResp); err != nil {
-		return 0, err
+	return nil
+}
+
+// unpinAllChatMessages clears the chat's pinned messages.
+func (c *TelegramClient) unpinAllChatMessages(chatID string) error {
+	if err := c.call("unpinAllChatMessages", map[string]interface{}{"chat_id": chatID}, nil); err != nil {
+		return fmt.Errorf("failed to unpin messages: %w", adminRightsError(err, chatID, "Edit messages"))
 	}
-	if !mediaResp.OK {
-		return 0, fmt.Errorf("telegram API error: %s", mediaResp.Description)
+	fmt.Fprintln(os.Stderr, "Successfully unpinned all messages")
+	return nil
+}
+
+// adminRightsError adds a hint to Telegram's terse permission errors (403, "not enough rights",
+// "CHAT_ADMIN_REQUIRED", ...) naming the admin right the bot needs in chatID.
+func adminRightsError(err error, chatID, right string) error {
+	var tgErr *TelegramError
+	if !errors.As(err, &tgErr) {
+		return err
 	}
-	if len(mediaResp.Result) > 0 {
-		firstMessageID = mediaResp.Result[0].MessageID
-		ids := make([]string, len(mediaResp.Result))
-		for i, m := range mediaResp.Result {
-			ids[i] = strconv.FormatInt(m.MessageID, 10)
-		}
-		fmt.Fprintf(os.Stderr, "Successfully posted %d photo(s) to Telegram channel (message_ids: %s)\n", len(photoPaths), strings.Join(ids, ", "))
-	} else {
-		fmt.Fprintf(os.Stderr, "Successfully posted %d photo(s) to Telegram channel\n", len(photoPaths))
+	desc := strings.ToLower(tgErr.Description)
+	if tgErr.ErrorCode == http.StatusForbidden || strings.Contains(desc, "not enough rights") ||
+		strings.Contains(desc, "admin") || strings.Contains(desc, "can't be deleted") {
+		return fmt.Errorf("%w (make the bot an administrator of %s with the %q right)", err, chatID, right)
 	}
-	return firstMessageID, nil
+	return err
 }
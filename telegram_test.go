@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// telegramStub answers Bot API calls with the given responses in order, repeating the last one,
+// and counts the requests.
+func telegramStub(t *testing.T, responses ...TelegramResponse) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1)) - 1
+		if n >= len(responses) {
+			n = len(responses) - 1
+		}
+		resp := responses[n]
+		if !resp.OK {
+			w.WriteHeader(resp.ErrorCode)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func telegramOK() TelegramResponse {
+	return TelegramResponse{OK: true, Result: json.RawMessage(`{"message_id":1}`)}
+}
+
+func telegramFail(code, retryAfter int) TelegramResponse {
+	r := TelegramResponse{ErrorCode: code, Description: http.StatusText(code)}
+	if retryAfter > 0 {
+		r.Parameters = &struct {
+			RetryAfter      int   `json:"retry_after,omitempty"`
+			MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"`
+		}{RetryAfter: retryAfter}
+	}
+	return r
+}
+
+func TestTelegramClientRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    []TelegramResponse
+		maxRetries   int
+		backoff      time.Duration
+		maxRetryWait time.Duration
+		wantCalls    int32
+		wantErr      string
+		minElapsed   time.Duration
+	}{
+		{
+			name:       "success needs no retry",
+			responses:  []TelegramResponse{telegramOK()},
+			maxRetries: 3, backoff: time.Millisecond, maxRetryWait: time.Second,
+			wantCalls: 1,
+		},
+		{
+			name:       "server errors are retried with backoff",
+			responses:  []TelegramResponse{telegramFail(500, 0), telegramFail(502, 0), telegramOK()},
+			maxRetries: 3, backoff: time.Millisecond, maxRetryWait: time.Second,
+			wantCalls: 3,
+		},
+		{
+			// The backoff alone would exceed max_retry_wait, so success shows retry_after was used.
+			name:       "retry_after is honoured",
+			responses:  []TelegramResponse{telegramFail(429, 1), telegramOK()},
+			maxRetries: 3, backoff: time.Hour, maxRetryWait: 5 * time.Second,
+			wantCalls: 2, minElapsed: time.Second,
+		},
+		{
+			name:       "wait over max_retry_wait is not slept",
+			responses:  []TelegramResponse{telegramFail(429, 120), telegramOK()},
+			maxRetries: 3, backoff: time.Millisecond, maxRetryWait: time.Second,
+			wantCalls: 1, wantErr: "exceeds max_retry_wait",
+		},
+		{
+			name:       "client errors are not retried",
+			responses:  []TelegramResponse{telegramFail(400, 0), telegramOK()},
+			maxRetries: 3, backoff: time.Millisecond, maxRetryWait: time.Second,
+			wantCalls: 1, wantErr: "telegram API error 400",
+		},
+		{
+			name:       "gives up after max retries",
+			responses:  []TelegramResponse{telegramFail(503, 0)},
+			maxRetries: 2, backoff: time.Millisecond, maxRetryWait: time.Second,
+			wantCalls: 3, wantErr: "telegram API error 503",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := telegramStub(t, tt.responses...)
+			c := &TelegramClient{BaseURL: srv.URL, Token: "TOKEN", Timeout: 5 * time.Second, UploadTimeout: 5 * time.Second,
+				MaxRetries: tt.maxRetries, RetryBackoff: tt.backoff, MaxRetryWait: tt.maxRetryWait, HTTPClient: srv.Client()}
+			start := time.Now()
+			var msg telegramMessage
+			err := c.call("sendMessage", map[string]interface{}{"chat_id": "@c", "text": "hi"}, &msg)
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Errorf("%d requests, want %d", got, tt.wantCalls)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if msg.MessageID != 1 {
+					t.Errorf("message_id = %d, want 1", msg.MessageID)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("returned after %s, want at least %s", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestTelegramClientMaxRetriesZero(t *testing.T) {
+	srv, calls := telegramStub(t, telegramFail(500, 0), telegramOK())
+	zero := 0
+	c := newTelegramClient(TelegramConfig{APIURL: srv.URL, BotToken: "TOKEN", MaxRetries: &zero})
+	err := c.call("sendMessage", map[string]interface{}{"chat_id": "@c", "text": "hi"}, nil)
+	var apiErr *TelegramError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode != 500 {
+		t.Fatalf("error = %v, want a TelegramError 500", err)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("%d requests with max_retries = 0, want 1", got)
+	}
+}
+
+func TestTelegramClientDefaults(t *testing.T) {
+	c := newTelegramClient(TelegramConfig{BotToken: "TOKEN"})
+	if c.MaxRetries != defaultTelegramMaxRetries || c.RetryBackoff != defaultTelegramRetryBackoff || c.MaxRetryWait != defaultTelegramMaxRetryWait {
+		t.Errorf("retries = %d, backoff = %s, max wait = %s; want the defaults", c.MaxRetries, c.RetryBackoff, c.MaxRetryWait)
+	}
+	if c.BaseURL != defaultTelegramAPIURL {
+		t.Errorf("BaseURL = %q, want %q", c.BaseURL, defaultTelegramAPIURL)
+	}
+}
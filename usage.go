@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// recordUsage saves the token usage of one LLM call in the history DB, through db or, when nil, a
+// handle opened for the call. Calls whose provider reported no usage are skipped; failures are
+// reported on stderr but never fail the call itself.
+func recordUsage(db *sql.DB, p chatProvider, usage *chatUsage, source string) {
+	if usage == nil {
+		return
+	}
+	if db == nil {
+		var err error
+		if db, err = initHistoryDB(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to open history DB: %v\n", err)
+			return
+		}
+		defer db.Close()
+	}
+	_, err := db.Exec(`INSERT INTO llm_usage (provider, model, source, prompt_tokens, completion_tokens, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		p.Name(), p.Model(), source, usage.PromptTokens, usage.CompletionTokens, time.Now().Format(historyTimeLayout))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record token usage: %v\n", err)
+	}
+}
+
+// usageCost prices prompt and completion tokens of model from the [prices] table; ok is false when
+// the model has no price.
+func usageCost(prices map[string]PriceConfig, model string, promptTokens, completionTokens int) (cost float64, ok bool) {
+	price, ok := prices[model]
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6, true
+}
+
+// formatCost renders a cost in dollars with enough digits for single cheap calls.
+func formatCost(cost float64) string {
+	if cost < 0.01 && cost > 0 {
+		return fmt.Sprintf("$%.6f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
+
+// Usage runs "cairn usage": token usage and cost of LLM calls, grouped by day and model.
+func Usage(args []string) error {
+	fs := pflag.NewFlagSet("usage", pflag.ContinueOnError)
+	configPath := fs.StringP("config", "c", "~/.cairn.toml", "Path to config file (for [prices])")
+	since := fs.String("since", "", "Only calls on or after this date (YYYY-MM-DD or \"YYYY-MM-DD HH:MM\")")
+	until := fs.String("until", "", "Only calls on or before this date (YYYY-MM-DD or \"YYYY-MM-DD HH:MM\")")
+	model := fs.String("model", "", "Only calls to this model")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	query := `SELECT substr(created_at, 1, 10) AS day, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens)
+		FROM llm_usage WHERE 1=1`
+	var qargs []interface{}
+	if *since != "" {
+		s, err := parseHistoryDate(*since, false)
+		if err != nil {
+			return err
+		}
+		query += ` AND created_at >= ?`
+		qargs = append(qargs, s)
+	}
+	if *until != "" {
+		u, err := parseHistoryDate(*until, true)
+		if err != nil {
+			return err
+		}
+		query += ` AND created_at < ?`
+		qargs = append(qargs, u)
+	}
+	if *model != "" {
+		query += ` AND model = ?`
+		qargs = append(qargs, *model)
+	}
+	query += ` GROUP BY day, model ORDER BY day DESC, model`
+
+	db, err := initHistoryDB()
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer db.Close()
+	rows, err := db.Query(query, qargs...)
+	if err != nil {
+		return fmt.Errorf("failed to read usage: %w", err)
+	}
+	defer rows.Close()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	var calls, promptTokens, completionTokens int
+	var total float64
+	unpriced := map[string]bool{}
+	n := 0
+	for rows.Next() {
+		var day, m string
+		var c, pt, ct int
+		if err := rows.Scan(&day, &m, &c, &pt, &ct); err != nil {
+			return err
+		}
+		if n == 0 {
+			fmt.Fprintln(tw, "DAY\tMODEL\tCALLS\tPROMPT\tCOMPLETION\tTOTAL\tCOST")
+		}
+		n++
+		costText := "-"
+		if cost, ok := usageCost(config.Prices, m, pt, ct); ok {
+			costText = formatCost(cost)
+			total += cost
+		} else {
+			unpriced[m] = true
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", day, m, c, pt, ct, pt+ct, costText)
+		calls, promptTokens, completionTokens = calls+c, promptTokens+pt, completionTokens+ct
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if n == 0 {
+		fmt.Fprintln(os.Stderr, "No LLM usage recorded")
+		return nil
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%d\t%d\t%d\t%d\t%s\n", calls, promptTokens, completionTokens, promptTokens+completionTokens, formatCost(total))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(unpriced) > 0 {
+		var names []string
+		for m := range unpriced {
+			names = append(names, m)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "No price for %s; add [prices.\"MODEL\"] input/output (per million tokens) to the config to include them in the cost\n", strings.Join(names, ", "))
+	}
+	return nil
+}
@@ -1,133 +1,166 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
-	"time"
 )
 
-const (
-	openRouterURL = "https://openrouter.ai/api/v1/chat/completions"
-	openAIURL     = "https://api.openai.com/v1/chat/completions"
-)
-
-type openRouterReq struct {
-	Model    string          `json:"model"`
-	Messages []openRouterMsg `json:"messages"`
-	Stream   bool            `json:"stream,omitempty"`
-}
-
-type openRouterMsg struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type openRouterChoice struct {
-	Message openRouterMsg `json:"message"`
-	Delta   *struct {
-		Content string `json:"content"`
-	} `json:"delta,omitempty"`
+// writerOptions says what Writer does with the generated content.
+type writerOptions struct {
+	OutputPath string
+	// Post, if set, is sent to the channel with the generated content as its text (flow "writer").
+	Post *outgoingPost
+	// Format is the input format of the generated text when posting (see formatContent).
+	Format string
+	// Review opens the content in $EDITOR before posting.
+	Review bool
+	// Usage prints the token usage reported at the end of the stream.
+	Usage bool
+	// Vars fill template variables in the prompt file (--var NAME=VALUE).
+	Vars map[string]string
+	// Verbose prints the provider, model and effective generation settings of each request.
+	Verbose bool
 }
 
-type streamChunk struct {
-	Choices []openRouterChoice `json:"choices"`
-}
-
-// Writer reads prompt from settingPath, calls OpenAI or OpenRouter (streaming), writes result to outputPath if set.
-func Writer(config *Config, settingPath, outputPath string) error {
-	useOpenAI := config.OpenAI.APIKey != "" && config.OpenAI.Model != ""
-	useOpenRouter := config.OpenRouter.APIKey != "" && config.OpenRouter.Model != ""
-	if !useOpenAI && !useOpenRouter {
-		return fmt.Errorf("for -W/--writer, set either [openai] api_key and model, or [openrouter] api_key and model in config")
-	}
-	prompt, err := readFileContent(settingPath)
+// Writer reads the prompt file at settingPath (see loadPrompt), calls the configured LLM provider and streams the reply to
+// stdout as it arrives (to stderr when writing to opts.OutputPath), then with opts.Post optionally
+// reviews and posts it.
+func Writer(config *Config, settingPath string, opts writerOptions) error {
+	chain, err := writerProviders(config)
 	if err != nil {
-		return fmt.Errorf("failed to read setting file: %w", err)
-	}
-	prompt = strings.TrimSpace(prompt)
-	if prompt == "" {
-		return fmt.Errorf("setting file is empty")
+		return err
 	}
-	var apiURL, apiKey, apiName string
-	if useOpenAI {
-		apiURL = openAIURL
-		apiKey = config.OpenAI.APIKey
-		apiName = "OpenAI"
-	} else {
-		apiURL = openRouterURL
-		apiKey = config.OpenRouter.APIKey
-		apiName = "OpenRouter"
-	}
-	model := config.OpenAI.Model
-	if !useOpenAI {
-		model = config.OpenRouter.Model
-	}
-	reqBody := openRouterReq{
-		Model:    model,
-		Messages: []openRouterMsg{{Role: "user", Content: prompt}},
-		Stream:   true,
-	}
-	jsonData, err := json.Marshal(reqBody)
+	prompt, err := loadPrompt(settingPath, opts.Vars)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	if !prompt.hasBody() {
+		return fmt.Errorf("setting file is empty")
+	}
+	// Stream to stdout, or to stderr when stdout is not where the result goes.
+	var out io.Writer = os.Stdout
+	if opts.OutputPath != "" {
+		out = os.Stderr
+	}
+	provider, res, err := streamReply(chain, writerRetryPolicy(config.Writer), chatRequest{
+		Messages: prompt.Messages,
+		Params:   prompt.Params,
+		Source:   "writer",
+	}, out, opts.Verbose)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	client := &http.Client{Timeout: 10 * time.Minute}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to call %s: %w", apiName, err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("%s API error: %d %s", apiName, resp.StatusCode, string(body))
-	}
-	var contentBuilder strings.Builder
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" || strings.HasPrefix(line, ": ") {
-			continue
-		}
-		if !strings.HasPrefix(line, "data: ") {
-			continue
+	model := provider.Model()
+	if len(chain) > 1 {
+		fmt.Fprintf(os.Stderr, "Generated by %s\n", providerLabel(provider))
+	}
+	if opts.Usage {
+		if u := res.Usage; u != nil {
+			cost := ""
+			if c, ok := usageCost(config.Prices, model, u.PromptTokens, u.CompletionTokens); ok {
+				cost = ", " + formatCost(c)
+			}
+			fmt.Fprintf(os.Stderr, "Usage (%s): %d prompt + %d completion = %d tokens%s\n", model, u.PromptTokens, u.CompletionTokens, u.TotalTokens, cost)
+		} else {
+			fmt.Fprintf(os.Stderr, "Usage: %s did not report token usage\n", provider.Name())
 		}
-		payload := strings.TrimSpace(strings.TrimPrefix(line, "data: "))
-		if payload == "" || payload == "[DONE]" {
-			continue
+	}
+	content := strings.TrimSpace(res.Content)
+	if opts.OutputPath != "" {
+		if err := os.WriteFile(opts.OutputPath, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
 		}
-		var chunk streamChunk
-		if json.Unmarshal([]byte(payload), &chunk) != nil {
-			continue
+		fmt.Fprintf(os.Stderr, "Wrote result to %s\n", opts.OutputPath)
+	}
+	fmt.Fprintln(os.Stderr, "Successfully generated content")
+	if opts.Post == nil {
+		return nil
+	}
+	if opts.Review {
+		if content, err = reviewInEditor(content); err != nil {
+			return err
 		}
-		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta != nil {
-			contentBuilder.WriteString(chunk.Choices[0].Delta.Content)
+		if content == "" {
+			return fmt.Errorf("post aborted: content is empty after review")
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to read stream: %w", err)
+	text, err := formatContent(content, opts.Format)
+	if err != nil {
+		return err
 	}
-	content := strings.TrimSpace(contentBuilder.String())
-	if content == "" {
-		return fmt.Errorf("API returned empty content")
+	post := *opts.Post
+	post.Text, post.Flow, post.Model = text, "writer", model
+	if post.PromptPath, err = filepath.Abs(settingPath); err != nil {
+		post.PromptPath = settingPath
 	}
-	if outputPath != "" {
-		if err := os.WriteFile(outputPath, []byte(content), 0644); err != nil {
-			return fmt.Errorf("failed to write output file: %w", err)
-		}
-		fmt.Fprintf(os.Stderr, "Wrote result to %s\n", outputPath)
+	if _, err := sendPost(config, &post); err != nil {
+		return fmt.Errorf("failed to post to Telegram: %w", err)
 	}
-	fmt.Fprintln(os.Stderr, "Successfully generated content")
 	return nil
 }
+
+// streamReply runs req through the provider chain, printing the reply to out as it streams in
+// (without leading blank lines, and ending with a newline). With verbose, the provider and effective
+// generation settings of each attempt go to stderr.
+func streamReply(chain []chatProvider, policy retryPolicy, req chatRequest, out io.Writer, verbose bool) (chatProvider, *chatResult, error) {
+	partial := "" // what the current attempt has printed so far
+	provider, res, err := streamChatChain(chain, policy, req, func(delta string) {
+		if partial == "" {
+			if delta = strings.TrimLeft(delta, " \n"); delta == "" {
+				return
+			}
+		}
+		partial += delta
+		io.WriteString(out, delta)
+	}, func(p chatProvider, retry bool) {
+		// A failed attempt may have streamed part of a reply; end its line before the next one.
+		if retry && partial != "" && !strings.HasSuffix(partial, "\n") {
+			io.WriteString(out, "\n")
+		}
+		partial = ""
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Request to %s: %d message(s), %s\n", providerLabel(p), len(req.Messages), sentParams(p, req.Params))
+		}
+	})
+	if partial != "" && !strings.HasSuffix(partial, "\n") {
+		io.WriteString(out, "\n")
+	}
+	return provider, res, err
+}
+
+// reviewInEditor opens content in $VISUAL or $EDITOR (default vi) and returns the saved text,
+// trimmed; an emptied file means the user wants to abort.
+func reviewInEditor(content string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	f, err := os.CreateTemp("", "cairn-review-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create review file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(content + "\n"); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write review file: %w", err)
+	}
+	f.Close()
+	args := append(strings.Fields(editor), f.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read review file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}